@@ -11,3 +11,5 @@ func cacheKey(v interface{}) (string, error) {
 	key, err := json.Marshal(v)
 	return string(key), err
 }
+
+var metadataCache sync.Map
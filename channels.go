@@ -1,9 +1,14 @@
 package maprobe
 
+import (
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
 type Channels struct {
 	ServiceMetrics chan ServiceMetric
 	HostMetrics    chan HostMetric
 	OtelMetrics    chan Metric
+	CheckReports   chan *mackerel.CheckReport
 	Destination    *DestinationConfig
 }
 
@@ -12,13 +17,14 @@ func NewChannels(dst *DestinationConfig) *Channels {
 		ServiceMetrics: make(chan ServiceMetric, PostMetricBufferLength*10),
 		HostMetrics:    make(chan HostMetric, PostMetricBufferLength*10),
 		OtelMetrics:    make(chan Metric, PostMetricBufferLength*10),
+		CheckReports:   make(chan *mackerel.CheckReport, PostMetricBufferLength),
 		Destination:    dst,
 	}
 	return &chs
 }
 
 func (ch *Channels) SendServiceMetric(m ServiceMetric) {
-	if ch.Destination.Mackerel.Enabled {
+	if ch.Destination.Mackerel.Enabled && !m.OtelOnly {
 		ch.ServiceMetrics <- m
 	}
 	if ch.Destination.Otel.Enabled {
@@ -27,7 +33,7 @@ func (ch *Channels) SendServiceMetric(m ServiceMetric) {
 }
 
 func (ch *Channels) SendHostMetric(m HostMetric) {
-	if ch.Destination.Mackerel.Enabled {
+	if ch.Destination.Mackerel.Enabled && !m.OtelOnly {
 		ch.HostMetrics <- m
 	}
 	if ch.Destination.Otel.Enabled {
@@ -42,8 +48,15 @@ func (ch *Channels) SendAggregatedMetric(m ServiceMetric) {
 	// TODO: Otel Aggregated Metrics
 }
 
+func (ch *Channels) SendCheckReport(r *mackerel.CheckReport) {
+	if ch.Destination.Mackerel.Enabled {
+		ch.CheckReports <- r
+	}
+}
+
 func (ch *Channels) Close() {
 	close(ch.ServiceMetrics)
 	close(ch.HostMetrics)
 	close(ch.OtelMetrics)
+	close(ch.CheckReports)
 }
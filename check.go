@@ -0,0 +1,200 @@
+package maprobe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+var (
+	DefaultCheckTimeout         = 30 * time.Second
+	DefaultCheckMetricKeyPrefix = "check"
+
+	// CheckMessageMaxLength is the max length of a message of a check report accepted by Mackerel.
+	CheckMessageMaxLength = 1024
+)
+
+var checkMetricNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// checkStatuses maps exit codes of check plugins to check statuses.
+var checkStatuses = map[int]mackerel.CheckStatus{
+	0: mackerel.CheckStatusOK,
+	1: mackerel.CheckStatusWarning,
+	2: mackerel.CheckStatusCritical,
+	3: mackerel.CheckStatusUnknown,
+}
+
+// CheckReporter is implemented by probes which report the result to Mackerel as a check monitoring.
+type CheckReporter interface {
+	CheckReport() *mackerel.CheckReport
+}
+
+type CheckProbeConfig struct {
+	Name                 string            `yaml:"name"`
+	RawCommand           interface{}       `yaml:"command"`
+	command              []string          `yaml:"-"`
+	Timeout              time.Duration     `yaml:"timeout"`
+	Env                  map[string]string `yaml:"env"`
+	NotificationInterval uint              `yaml:"notification_interval"`
+	MaxCheckAttempts     uint              `yaml:"max_check_attempts"`
+	MetricKeyPrefix      string            `yaml:"metric_key_prefix"`
+
+	CommandExecConfig `yaml:",inline"`
+}
+
+func (pc *CheckProbeConfig) initialize() error {
+	if pc.Name == "" {
+		return fmt.Errorf("check name is empty")
+	}
+	var err error
+	pc.command, err = parseCommand(pc.RawCommand)
+	return err
+}
+
+func (pc *CheckProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
+	p := &CheckProbe{
+		hostID:               host.ID,
+		metricKeyPrefix:      pc.MetricKeyPrefix,
+		Timeout:              pc.Timeout,
+		NotificationInterval: pc.NotificationInterval,
+		MaxCheckAttempts:     pc.MaxCheckAttempts,
+	}
+	var err error
+
+	p.Name, err = expandPlaceHolder(pc.Name, host, pc.Env)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name: %w", err)
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("no name")
+	}
+
+	p.Command, err = expandCommand(pc.command, host, pc.Env)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Command) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+	p.exec, err = pc.CommandExecConfig.newCommandExec(host, pc.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Timeout == 0 {
+		p.Timeout = DefaultCheckTimeout
+	}
+	if p.metricKeyPrefix == "" {
+		p.metricKeyPrefix = DefaultCheckMetricKeyPrefix + "." + checkMetricNameInvalidChars.ReplaceAllString(p.Name, "_")
+	}
+	for name, value := range pc.Env {
+		v, err := expandPlaceHolder(value, host, pc.Env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env %s: %w", name, err)
+		}
+		p.env = append(p.env, name+"="+v)
+	}
+	return p, nil
+}
+
+type CheckProbe struct {
+	hostID          string
+	metricKeyPrefix string
+	env             []string
+	exec            *commandExec
+	report          *mackerel.CheckReport
+
+	Name                 string
+	Command              []string
+	Timeout              time.Duration
+	NotificationInterval uint
+	MaxCheckAttempts     uint
+}
+
+func (p *CheckProbe) HostID() string {
+	return p.hostID
+}
+
+func (p *CheckProbe) MetricName(name string) string {
+	return p.metricKeyPrefix + "." + name
+}
+
+func (p *CheckProbe) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// CheckReport returns the report of the last run.
+func (p *CheckProbe) CheckReport() *mackerel.CheckReport {
+	return p.report
+}
+
+func (p *CheckProbe) Run(ctx context.Context) (ms Metrics, err error) {
+	code := 3
+	var message string
+	start := time.Now()
+	defer func() {
+		status := checkStatuses[code]
+		if r := []rune(message); len(r) > CheckMessageMaxLength {
+			message = string(r[:CheckMessageMaxLength])
+		}
+		p.report = &mackerel.CheckReport{
+			Source:               mackerel.NewCheckSourceHost(p.hostID),
+			Name:                 p.Name,
+			Status:               status,
+			Message:              message,
+			OccurredAt:           start.Unix(),
+			NotificationInterval: p.NotificationInterval,
+			MaxCheckAttempts:     p.MaxCheckAttempts,
+		}
+
+		// the result is reported to Mackerel as a check monitoring, so metrics are for OpenTelemetry
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, "elapsed.seconds", elapsed.Seconds()))
+		ms = append(ms, newMetric(p, "status", float64(code)))
+		for i := range ms {
+			ms[i].OtelOnly = true
+		}
+		slog.Debug("check probe completed", "name", p.Name, "status", status, "message", message, "metrics", ms.String())
+	}()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	cmd := p.exec.command(timeoutCtx, p.Command[0], p.Command[1:], "check", p.Name)
+	defer flushStderr(cmd)
+	cmd.Env = append(cmd.Env, p.env...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err = cmd.Run()
+	message = strings.TrimSpace(stdout.String())
+	if timeoutCtx.Err() != nil {
+		message = fmt.Sprintf("command timed out after %s. %s", p.Timeout, message)
+		return ms, fmt.Errorf("check command timed out: %s", strings.Join(p.Command, " "))
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			message = fmt.Sprintf("command execute failed: %s", err)
+			return ms, fmt.Errorf("command execute failed. %s: %w", strings.Join(p.Command, " "), err)
+		}
+		code = exitErr.ExitCode()
+	} else {
+		code = 0
+	}
+	if _, ok := checkStatuses[code]; !ok {
+		// other exit codes are treated as UNKNOWN like mackerel-agent
+		code = 3
+	}
+	return ms, nil
+}
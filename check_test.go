@@ -0,0 +1,93 @@
+package maprobe_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+var checkProbesExpect = []struct {
+	name        string
+	status      mackerel.CheckStatus
+	message     string
+	code        float64
+	expectError bool
+}{
+	{name: "check-ok-test", status: mackerel.CheckStatusOK, message: "OK: test", code: 0},
+	{name: "check-warning", status: mackerel.CheckStatusWarning, message: "WARNING: foo", code: 1},
+	{name: "check-critical", status: mackerel.CheckStatusCritical, message: "CRITICAL", code: 2},
+	{name: "check-unknown", status: mackerel.CheckStatusUnknown, message: "UNKNOWN", code: 3},
+	{name: "check-other", status: mackerel.CheckStatusUnknown, message: "other", code: 3},
+	{name: "check-long", status: mackerel.CheckStatusOK, message: strings.Repeat("x", maprobe.CheckMessageMaxLength), code: 0},
+	{name: "check-timeout", status: mackerel.CheckStatusUnknown, message: "command timed out after 500ms. started", code: 3, expectError: true},
+}
+
+func TestCheck(t *testing.T) {
+	c, _, err := maprobe.LoadConfig(context.Background(), "test/check.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pd := range c.Probes {
+		expect := checkProbesExpect[i]
+		t.Run(expect.name, func(t *testing.T) {
+			probe, err := pd.Check.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if expect.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !expect.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			r := probe.(maprobe.CheckReporter).CheckReport()
+			if r == nil {
+				t.Fatal("no check report")
+			}
+			if r.Name != expect.name || r.Status != expect.status || r.Message != expect.message {
+				t.Errorf("unexpected report %#v", r)
+			}
+			if r.Source.CheckType() != "host" {
+				t.Errorf("unexpected source %#v", r.Source)
+			}
+
+			// a failing check is a successful execution of the probe
+			attrs := maprobe.ProbeExecutionAttributes(probe, err)
+			if status := attrs["status"]; expect.expectError != (status == "error") {
+				t.Errorf("unexpected execution status %s", status)
+			}
+			if attrs["check_status"] != string(expect.status) {
+				t.Errorf("unexpected check_status %s, want %s", attrs["check_status"], expect.status)
+			}
+
+			var found bool
+			for _, m := range ms {
+				if !m.OtelOnly {
+					t.Errorf("%s must be otel only", m.Name)
+				}
+				if m.Name == probe.MetricName("status") {
+					found = true
+					if m.Value != expect.code {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, expect.code)
+					}
+				}
+			}
+			if !found {
+				t.Error("status metric not found")
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestCheckFail(t *testing.T) {
+	c, _, err := maprobe.LoadConfig(context.Background(), "test/check_fail.yaml")
+	if err == nil {
+		t.Errorf("must be failed but got %#v", c)
+	}
+}
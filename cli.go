@@ -7,6 +7,7 @@ type CLI struct {
 	LogLevel    string `name:"log-level" help:"log level" default:"info" env:"LOG_LEVEL"`
 	LogFormat   string `name:"log-format" help:"log format (text|json)" default:"text" enum:"text,json" env:"LOG_FORMAT"`
 	GopsEnabled bool   `name:"gops" help:"enable gops agent" default:"false" env:"GOPS"`
+	SecretsFile string `name:"secrets-file" help:"file of secrets used instead of SSM and Secrets Manager (for testing)" env:"SECRETS_FILE"`
 
 	Version          VersionCmd          `cmd:"" help:"Show version"`
 	Agent            AgentCmd            `cmd:"" help:"Run agent"`
@@ -14,8 +15,10 @@ type CLI struct {
 	Lambda           LambdaCmd           `cmd:"" help:"Run on AWS Lambda like once mode"`
 	Ping             PingCmd             `cmd:"" help:"Run ping probe"`
 	TCP              TCPCmd              `cmd:"" help:"Run TCP probe"`
+	UDP              UDPCmd              `cmd:"" help:"Run UDP probe"`
 	HTTP             HTTPCmd             `cmd:"" help:"Run HTTP probe"`
 	GRPC             GRPCCmd             `cmd:"" help:"Run gRPC probe"`
+	DNS              DNSCmd              `cmd:"" help:"Run DNS probe"`
 	FirehoseEndpoint FirehoseEndpointCmd `cmd:"" help:"Run Firehose HTTP endpoint"`
 }
 
@@ -27,24 +30,31 @@ type AgentCmd struct {
 	Config               string `short:"c" help:"configuration file path or URL(http|s3)" env:"CONFIG"`
 	WithFirehoseEndpoint bool   `help:"run with firehose HTTP endpoint server"`
 	Port                 int    `help:"firehose HTTP endpoint listen port" default:"8080"`
+	ShardFlags           `embed:""`
 }
 
 // OnceCmd represents the once command that runs probes once and exits
 type OnceCmd struct {
-	Config string `short:"c" help:"configuration file path or URL(http|s3)" env:"CONFIG"`
+	Config     string `short:"c" help:"configuration file path or URL(http|s3)" env:"CONFIG"`
+	ShardFlags `embed:""`
 }
 
 // LambdaCmd represents the lambda command that runs on AWS Lambda
 type LambdaCmd struct {
-	Config string `short:"c" help:"configuration file path or URL(http|s3)" env:"CONFIG"`
+	Config     string `short:"c" help:"configuration file path or URL(http|s3)" env:"CONFIG"`
+	ShardFlags `embed:""`
 }
 
 // PingCmd represents the ping command for standalone ping probe
 type PingCmd struct {
-	Address string        `arg:"" help:"Hostname or IP address" required:""`
-	Count   int           `short:"c" help:"Iteration count"`
-	Timeout time.Duration `short:"t" help:"Timeout to ping response"`
-	HostID  string        `short:"i" help:"Mackerel host ID"`
+	Address      string        `arg:"" help:"Hostname or IP address" required:""`
+	Count        int           `short:"c" help:"Iteration count"`
+	Timeout      time.Duration `short:"t" help:"Timeout to ping response"`
+	HostID       string        `short:"i" help:"Mackerel host ID"`
+	IPVersion    int           `name:"ip-version" help:"IP version (4 or 6)"`
+	Size         int           `short:"s" help:"Size in bytes of the payload"`
+	Interval     time.Duration `help:"Interval between pings"`
+	Unprivileged bool          `help:"Prefer unprivileged ICMP datagram sockets to raw sockets"`
 }
 
 // TCPCmd represents the TCP command for standalone TCP probe
@@ -58,6 +68,21 @@ type TCPCmd struct {
 	NoCheckCertificate bool          `short:"k" help:"Do not check certificate"`
 	HostID             string        `short:"i" help:"Mackerel host ID"`
 	TLS                bool          `help:"Use TLS"`
+	TLSClientFlags     `embed:""`
+}
+
+// UDPCmd represents the UDP command for standalone UDP probe
+type UDPCmd struct {
+	Host            string        `arg:"" help:"Hostname or IP address" required:""`
+	Port            string        `arg:"" help:"Port number" required:""`
+	Send            string        `short:"s" help:"String to send to the server"`
+	SendHex         string        `short:"x" name:"send-hex" help:"Hex-encoded bytes to send to the server"`
+	ExpectPattern   string        `short:"e" name:"expect" help:"Regexp pattern to expect in server response"`
+	ExpectPrefixHex string        `name:"expect-prefix-hex" help:"Hex-encoded bytes to expect at the beginning of server response"`
+	NoResponse      bool          `help:"Do not expect any response"`
+	Retries         *int          `short:"r" help:"Number of retries within the timeout"`
+	Timeout         time.Duration `short:"t" help:"Timeout"`
+	HostID          string        `short:"i" help:"Mackerel host ID"`
 }
 
 // HTTPCmd represents the HTTP command for standalone HTTP probe
@@ -70,6 +95,11 @@ type HTTPCmd struct {
 	NoCheckCertificate bool              `short:"k" help:"Do not check certificate"`
 	Headers            map[string]string `short:"H" name:"header" help:"Request headers" placeholder:"Header: Value"`
 	HostID             string            `short:"i" help:"Mackerel host ID"`
+	ExpectStatus       string            `short:"s" help:"Expected status codes (e.g. 200-299,304)"`
+	NoFollowRedirects  bool              `help:"Do not follow redirects"`
+	MaxRedirects       int               `help:"Max number of redirects to follow"`
+	ExpectFinalURL     string            `name:"expect-final-url" help:"Regexp pattern to expect in the final URL after redirects"`
+	TLSClientFlags     `embed:""`
 }
 
 // GRPCCmd represents the gRPC command for standalone gRPC probe
@@ -81,6 +111,52 @@ type GRPCCmd struct {
 	Metadata           map[string]string `short:"m" name:"metadata" help:"gRPC metadata" placeholder:"key:value"`
 	HostID             string            `short:"i" help:"Mackerel host ID"`
 	TLS                bool              `help:"Use TLS"`
+	Method             string            `help:"Unary method to invoke instead of health check (package.Service/Method)"`
+	Request            string            `help:"Request message in JSON for --method"`
+	DescriptorSet      string            `help:"Descriptor set file to resolve --method instead of server reflection"`
+	ExpectPattern      string            `short:"e" name:"expect" help:"Regexp pattern to expect in JSON-encoded response of --method"`
+	TLSClientFlags     `embed:""`
+}
+
+// DNSCmd represents the DNS command for standalone DNS probe
+type DNSCmd struct {
+	Server        string        `arg:"" help:"DNS server address" required:""`
+	Name          string        `arg:"" help:"Query name" required:""`
+	Type          string        `short:"q" name:"type" help:"Query type (A|AAAA|CNAME|MX|TXT|SRV|SOA)"`
+	Port          string        `short:"p" help:"DNS server port"`
+	ExpectPattern string        `short:"e" name:"expect" help:"Regexp pattern to expect in answers"`
+	Timeout       time.Duration `short:"t" help:"Timeout"`
+	NoRecursion   bool          `help:"Do not set recursion desired flag"`
+	HostID        string        `short:"i" help:"Mackerel host ID"`
+	TCP           bool          `help:"Use TCP"`
+}
+
+// TLSClientFlags represents TLS options shared by TLS-capable probe commands
+type TLSClientFlags struct {
+	ClientCert string `help:"Client certificate file for mutual TLS"`
+	ClientKey  string `help:"Client private key file for mutual TLS"`
+	CAFile     string `name:"ca-file" help:"CA certificate file to verify the server certificate"`
+	ServerName string `help:"Server name for SNI and certificate verification"`
+}
+
+func (f TLSClientFlags) TLSClientConfig() TLSClientConfig {
+	return TLSClientConfig{
+		ClientCert: f.ClientCert,
+		ClientKey:  f.ClientKey,
+		CAFile:     f.CAFile,
+		ServerName: f.ServerName,
+	}
+}
+
+// ShardFlags represents options to divide targets into multiple maprobe instances
+type ShardFlags struct {
+	ShardIndex int `name:"shard-index" help:"index of the shard handled by this instance (0 origin)" default:"0" env:"SHARD_INDEX"`
+	ShardCount int `name:"shard-count" help:"number of shards (0 or 1 disables sharding)" default:"0" env:"SHARD_COUNT"`
+}
+
+func (f ShardFlags) Shard() (Shard, error) {
+	s := Shard{Index: f.ShardIndex, Count: f.ShardCount}
+	return s, s.validate()
 }
 
 // FirehoseEndpointCmd represents the firehose endpoint command for HTTP server
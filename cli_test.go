@@ -81,6 +81,21 @@ func TestCLIParsing(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "once command with shard",
+			args: []string{"once", "--config", "/path/to/config.yaml", "--shard-index", "1"},
+			envs: map[string]string{
+				"SHARD_COUNT": "3",
+			},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				Once: OnceCmd{
+					Config:     "/path/to/config.yaml",
+					ShardFlags: ShardFlags{ShardIndex: 1, ShardCount: 3},
+				},
+			},
+		},
 		{
 			name: "lambda command",
 			args: []string{"lambda", "-c", "/path/to/config.yaml"},
@@ -120,6 +135,21 @@ func TestCLIParsing(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "ping command with ip version, size and interval",
+			args: []string{"ping", "example.com", "--ip-version", "6", "-s", "56", "--interval", "500ms", "--unprivileged"},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				Ping: PingCmd{
+					Address:      "example.com",
+					IPVersion:    6,
+					Size:         56,
+					Interval:     500 * time.Millisecond,
+					Unprivileged: true,
+				},
+			},
+		},
 		{
 			name: "tcp command basic",
 			args: []string{"tcp", "example.com", "80"},
@@ -194,6 +224,40 @@ func TestCLIParsing(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "http command with status and redirect options",
+			args: []string{"http", "https://example.com", "-s", "200-299,304", "--no-follow-redirects", "--max-redirects", "3", "--expect-final-url", "^https://example.com/"},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				HTTP: HTTPCmd{
+					URL:               "https://example.com",
+					Method:            "GET",
+					ExpectStatus:      "200-299,304",
+					NoFollowRedirects: true,
+					MaxRedirects:      3,
+					ExpectFinalURL:    "^https://example.com/",
+				},
+			},
+		},
+		{
+			name: "http command with client certificate",
+			args: []string{"http", "https://example.com", "--client-cert", "client.pem", "--client-key", "client-key.pem", "--ca-file", "ca.pem", "--server-name", "example.internal"},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				HTTP: HTTPCmd{
+					URL:    "https://example.com",
+					Method: "GET",
+					TLSClientFlags: TLSClientFlags{
+						ClientCert: "client.pem",
+						ClientKey:  "client-key.pem",
+						CAFile:     "ca.pem",
+						ServerName: "example.internal",
+					},
+				},
+			},
+		},
 		{
 			name: "http command with single header",
 			args: []string{"http", "https://example.com", "-H", "Content-Type=application/json"},
@@ -285,6 +349,83 @@ func TestCLIParsing(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "grpc command with method",
+			args: []string{"grpc", "localhost:50051", "--method", "example.v1.Users/Get", "--request", `{"id":1}`, "--descriptor-set", "users.pb", "-e", `"name"`},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				GRPC: GRPCCmd{
+					Address:       "localhost:50051",
+					Method:        "example.v1.Users/Get",
+					Request:       `{"id":1}`,
+					DescriptorSet: "users.pb",
+					ExpectPattern: `"name"`,
+				},
+			},
+		},
+		{
+			name: "udp command basic",
+			args: []string{"udp", "127.0.0.1", "8125", "-s", "ping"},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				UDP: UDPCmd{
+					Host: "127.0.0.1",
+					Port: "8125",
+					Send: "ping",
+				},
+			},
+		},
+		{
+			name: "udp command with all flags",
+			args: []string{"udp", "127.0.0.1", "1812", "-x", "0101", "--expect-prefix-hex", "02", "-e", "ok", "-r", "3", "-t", "3s", "-i", "host123"},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				UDP: UDPCmd{
+					Host:            "127.0.0.1",
+					Port:            "1812",
+					SendHex:         "0101",
+					ExpectPrefixHex: "02",
+					ExpectPattern:   "ok",
+					Retries:         func() *int { i := 3; return &i }(),
+					Timeout:         3 * time.Second,
+					HostID:          "host123",
+				},
+			},
+		},
+		{
+			name: "dns command basic",
+			args: []string{"dns", "127.0.0.1", "example.com"},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				DNS: DNSCmd{
+					Server: "127.0.0.1",
+					Name:   "example.com",
+				},
+			},
+		},
+		{
+			name: "dns command with all flags",
+			args: []string{"dns", "127.0.0.1", "example.com", "-q", "MX", "-p", "5353", "-e", "mail", "-t", "3s", "--no-recursion", "--tcp", "-i", "host123"},
+			expected: &CLI{
+				LogLevel:    "info",
+				GopsEnabled: false,
+				DNS: DNSCmd{
+					Server:        "127.0.0.1",
+					Name:          "example.com",
+					Type:          "MX",
+					Port:          "5353",
+					ExpectPattern: "mail",
+					Timeout:       3 * time.Second,
+					NoRecursion:   true,
+					HostID:        "host123",
+					TCP:           true,
+				},
+			},
+		},
 		{
 			name: "firehose-endpoint command",
 			args: []string{"firehose-endpoint", "-p", "9000"},
@@ -371,6 +512,18 @@ func TestCLIParsing(t *testing.T) {
 				if !reflect.DeepEqual(cli.HTTP, expected.HTTP) {
 					t.Errorf("HTTP = %+v, want %+v", cli.HTTP, expected.HTTP)
 				}
+			case "grpc":
+				if !reflect.DeepEqual(cli.GRPC, expected.GRPC) {
+					t.Errorf("GRPC = %+v, want %+v", cli.GRPC, expected.GRPC)
+				}
+			case "udp":
+				if !reflect.DeepEqual(cli.UDP, expected.UDP) {
+					t.Errorf("UDP = %+v, want %+v", cli.UDP, expected.UDP)
+				}
+			case "dns":
+				if !reflect.DeepEqual(cli.DNS, expected.DNS) {
+					t.Errorf("DNS = %+v, want %+v", cli.DNS, expected.DNS)
+				}
 			case "firehose-endpoint":
 				if !reflect.DeepEqual(cli.FirehoseEndpoint, expected.FirehoseEndpoint) {
 					t.Errorf("FirehoseEndpoint = %+v, want %+v", cli.FirehoseEndpoint, expected.FirehoseEndpoint)
@@ -397,10 +550,18 @@ func TestCLIErrorCases(t *testing.T) {
 			name: "tcp without port",
 			args: []string{"tcp", "example.com"},
 		},
+		{
+			name: "udp without port",
+			args: []string{"udp", "example.com"},
+		},
 		{
 			name: "http without url",
 			args: []string{"http"},
 		},
+		{
+			name: "dns without name",
+			args: []string{"dns", "127.0.0.1"},
+		},
 		{
 			name: "invalid command",
 			args: []string{"invalid"},
@@ -2,6 +2,7 @@ package maprobe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -61,6 +62,58 @@ func (client *Client) FindHosts(p *mackerel.FindHostsParam) ([]*mackerel.Host, e
 	return hosts, nil
 }
 
+// GetHostMetadata returns the host metadata of the namespace. It returns nil when the metadata does not exist.
+func (client *Client) GetHostMetadata(hostID, namespace string) (any, error) {
+	return getMetadata("host/"+hostID+"/"+namespace, func() (any, error) {
+		resp, err := client.mackerel.GetHostMetaData(hostID, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return resp.HostMetaData, nil
+	})
+}
+
+// GetServiceMetadata returns the service metadata of the namespace. It returns nil when the metadata does not exist.
+func (client *Client) GetServiceMetadata(service, namespace string) (any, error) {
+	return getMetadata("service/"+service+"/"+namespace, func() (any, error) {
+		resp, err := client.mackerel.GetServiceMetaData(service, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return resp.ServiceMetaData, nil
+	})
+}
+
+// GetRoleMetadata returns the role metadata of the namespace. It returns nil when the metadata does not exist.
+func (client *Client) GetRoleMetadata(service, role, namespace string) (any, error) {
+	return getMetadata("role/"+service+"/"+role+"/"+namespace, func() (any, error) {
+		resp, err := client.mackerel.GetRoleMetaData(service, role, namespace)
+		if err != nil {
+			return nil, err
+		}
+		return resp.RoleMetaData, nil
+	})
+}
+
+// getMetadata fetches the metadata.
+// When fetching the metadata failed, the previous cache is used.
+func getMetadata(key string, fetch func() (any, error)) (any, error) {
+	metadata, err := fetch()
+	if err != nil {
+		var apiErr *mackerel.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			if cached, found := metadataCache.Load(key); found {
+				slog.Warn("get metadata failed, using previous cache", "key", key, "error", err)
+				return cached, nil
+			}
+			return nil, fmt.Errorf("failed to get metadata %s: %w", key, err)
+		}
+		metadata = nil // not found
+	}
+	metadataCache.Store(key, metadata)
+	return metadata, nil
+}
+
 func (c *Client) PostServiceMetricValues(ctx context.Context, serviceName string, mvs []*mackerel.MetricValue) error {
 	err := c.mackerel.PostServiceMetricValues(serviceName, mvs)
 	if err == nil {
@@ -85,6 +138,10 @@ func (c *Client) PostHostMetricValues(ctx context.Context, mvs []*mackerel.HostM
 	return c.backupClient.PostHostMetricValues(ctx, mvs)
 }
 
+func (c *Client) PostCheckReports(ctx context.Context, reports []*mackerel.CheckReport) error {
+	return c.mackerel.PostCheckReports(&mackerel.CheckReports{Reports: reports})
+}
+
 func (c *Client) fetchLatestMetricValues(hostIDs []string, metricNames []string) (mackerel.LatestMetricValues, error) {
 	to := time.Now().Add(-1 * time.Minute)
 	from := to.Add(metricTimeMargin)
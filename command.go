@@ -7,13 +7,13 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	mackerel "github.com/mackerelio/mackerel-client-go"
@@ -21,7 +21,16 @@ import (
 
 const CustomPrefix = "custom."
 
-var DefaultCommandTimeout = 15 * time.Second
+var (
+	DefaultCommandTimeout             = 15 * time.Second
+	DefaultCommandExecMetricKeyPrefix = "command"
+)
+
+var commandOutputParsers = map[string]func(string) (Metric, error){
+	"mackerel":   parseMetricLine,
+	"json":       parseJSONMetricLine,
+	"prometheus": parsePrometheusMetricLine,
+}
 
 var graphDefsPosted = sync.Map{}
 
@@ -31,57 +40,81 @@ type CommandProbeConfig struct {
 	Timeout    time.Duration     `yaml:"timeout"`
 	GraphDefs  bool              `yaml:"graph_defs"`
 	Env        map[string]string `yaml:"env"`
+	Format     string            `yaml:"format"`
+
+	ExecMetrics         bool   `yaml:"exec_metrics"`
+	ExecMetricKeyPrefix string `yaml:"exec_metric_key_prefix"`
+
+	CommandExecConfig `yaml:",inline"`
 }
 
 func (pc *CommandProbeConfig) initialize() error {
-	switch c := pc.RawCommand.(type) {
+	var err error
+	pc.command, err = parseCommand(pc.RawCommand)
+	if err != nil {
+		return err
+	}
+	if _, ok := commandOutputParsers[pc.Format]; pc.Format != "" && !ok {
+		return fmt.Errorf("invalid format: %s (mackerel, json or prometheus)", pc.Format)
+	}
+	return nil
+}
+
+// parseCommand parses a command configuration, which is a string or an array of strings.
+func parseCommand(raw interface{}) ([]string, error) {
+	var command []string
+	switch c := raw.(type) {
 	case []interface{}:
 		if len(c) == 0 {
-			return fmt.Errorf("command is empty array")
+			return nil, fmt.Errorf("command is empty array")
 		}
 		for _, v := range c {
 			switch s := v.(type) {
 			case string:
-				pc.command = append(pc.command, s)
+				command = append(command, s)
 			default:
-				return fmt.Errorf("command must be array of string")
+				return nil, fmt.Errorf("command must be array of string")
 			}
 		}
 	case string:
 		if len(c) == 0 {
-			return fmt.Errorf("command is empty string")
+			return nil, fmt.Errorf("command is empty string")
 		}
-		pc.command = []string{c}
+		command = []string{c}
 	case nil:
-		return fmt.Errorf("command is empty")
+		return nil, fmt.Errorf("command is empty")
 	default:
-		return fmt.Errorf("invalid command: %#v", pc.RawCommand)
+		return nil, fmt.Errorf("invalid command: %#v", raw)
 	}
-	return nil
+	return command, nil
 }
 
-func (pc *CommandProbeConfig) GenerateProbe(host *mackerel.Host, client *mackerel.Client) (Probe, error) {
+func (pc *CommandProbeConfig) GenerateProbe(host *ProbeHost, client *mackerel.Client) (Probe, error) {
 	p := &CommandProbe{
 		Timeout:   pc.Timeout,
 		GraphDefs: pc.GraphDefs,
-		Command:   make([]string, len(pc.command)),
+		Format:    pc.Format,
+
+		ExecMetrics:         pc.ExecMetrics,
+		execMetricKeyPrefix: pc.ExecMetricKeyPrefix,
 	}
 	var err error
 
-	for i, c := range pc.command {
-		p.Command[i], err = expandPlaceHolder(c, host, pc.Env)
-		if err != nil {
-			return nil, fmt.Errorf("invalid command: %w", err)
-		}
+	p.Command, err = expandCommand(pc.command, host, pc.Env)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(p.Command) == 1 && strings.Contains(p.Command[0], " ") {
-		p.Command = []string{"sh", "-c", p.Command[0]}
+	p.exec, err = pc.CommandExecConfig.newCommandExec(host, pc.Env)
+	if err != nil {
+		return nil, err
 	}
 
 	if p.Timeout == 0 {
 		p.Timeout = DefaultCommandTimeout
 	}
+	if p.execMetricKeyPrefix == "" {
+		p.execMetricKeyPrefix = DefaultCommandExecMetricKeyPrefix
+	}
 
 	if p.GraphDefs && client != nil {
 		if err := p.PostGraphDefs(client, pc); err != nil {
@@ -89,18 +122,47 @@ func (pc *CommandProbeConfig) GenerateProbe(host *mackerel.Host, client *mackere
 		}
 	}
 	for name, value := range pc.Env {
-		p.env = append(p.env, name+"="+value)
+		v, err := expandPlaceHolder(value, host, pc.Env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env %s: %w", name, err)
+		}
+		p.env = append(p.env, name+"="+v)
 	}
 
 	return p, nil
 }
 
+// expandCommand expands placeholders in the command.
+// A single string command which contains spaces is executed by sh -c.
+func expandCommand(command []string, host *ProbeHost, env map[string]string) ([]string, error) {
+	expanded := make([]string, len(command))
+	for i, c := range command {
+		var err error
+		expanded[i], err = expandPlaceHolder(c, host, env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command: %w", err)
+		}
+	}
+	if len(expanded) == 1 && strings.Contains(expanded[0], " ") {
+		expanded = []string{"sh", "-c", expanded[0]}
+	}
+	return expanded, nil
+}
+
 type CommandProbe struct {
-	env []string
+	env                 []string
+	exec                *commandExec
+	execMetricKeyPrefix string
 
 	Command   []string
 	Timeout   time.Duration
 	GraphDefs bool
+
+	// Format of the command output. Empty means "mackerel".
+	Format string `json:",omitempty"`
+
+	// ExecMetrics reports metrics about the execution of the command.
+	ExecMetrics bool `json:",omitempty"`
 }
 
 func (p *CommandProbe) MetricName(name string) string {
@@ -129,27 +191,48 @@ func (p *CommandProbe) TempDir() string {
 }
 
 func (p *CommandProbe) Run(ctx context.Context) (ms Metrics, err error) {
+	exitCode := -1 // not exited normally (e.g. failed to start, killed by a signal)
+	var parsed, invalid int
+	start := time.Now()
+	if p.ExecMetrics {
+		defer func() {
+			now := time.Now()
+			for _, m := range []struct {
+				name  string
+				value float64
+			}{
+				{"exit_code", float64(exitCode)},
+				{"elapsed.seconds", now.Sub(start).Seconds()},
+				{"lines.parsed", float64(parsed)},
+				{"lines.invalid", float64(invalid)},
+			} {
+				ms = append(ms, Metric{
+					Name:      p.execMetricKeyPrefix + "." + m.name,
+					Value:     m.value,
+					Timestamp: now,
+				})
+			}
+		}()
+	}
+
 	// Create timeout context from parent context to allow cancellation
 	timeoutCtx, cancel := context.WithTimeout(ctx, p.Timeout)
 	defer cancel()
 
-	var cmd *exec.Cmd
-	switch len(p.Command) {
-	case 0:
+	if len(p.Command) == 0 {
 		return nil, fmt.Errorf("no command")
-	case 1:
-		cmd = exec.CommandContext(timeoutCtx, p.Command[0])
-	default:
-		cmd = exec.CommandContext(timeoutCtx, p.Command[0], p.Command[1:]...)
 	}
-	cmd.Env = append(cmd.Env, os.Environ()...)
-	cmd.Env = append(cmd.Env, p.env...)
-	cmd.Env = append(cmd.Env, "TMPDIR="+p.TempDir())
-	cmd.Stderr = os.Stderr
-	cmd.Cancel = func() error {
-		return cmd.Process.Signal(syscall.SIGTERM)
+	cmd := p.exec.command(timeoutCtx, p.Command[0], p.Command[1:], "command", strings.Join(p.Command, " "))
+	defer flushStderr(cmd)
+	tmpDir := p.TempDir()
+	if cred := p.exec.credential; cred != nil && tmpDir != os.TempDir() {
+		// the command runs as the user, so the TempDir must be writable by the user
+		if err := os.Chown(tmpDir, int(cred.Uid), int(cred.Gid)); err != nil {
+			slog.Warn("failed to chown TempDir", "dir", tmpDir, "error", err)
+		}
 	}
-	cmd.WaitDelay = 5 * time.Second // SIGKILL after 5 seconds
+	cmd.Env = append(cmd.Env, p.env...)
+	cmd.Env = append(cmd.Env, "TMPDIR="+tmpDir)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return ms, fmt.Errorf("stdout open failed: %w", err)
@@ -160,13 +243,26 @@ func (p *CommandProbe) Run(ctx context.Context) (ms Metrics, err error) {
 		return ms, fmt.Errorf("command execute failed. %s: %w", strings.Join(p.Command, " "), err)
 	}
 
+	parse := parseMetricLine
+	if p.Format != "" {
+		parse = commandOutputParsers[p.Format]
+	}
 	for scanner.Scan() {
-		slog.Debug("command output", "output", scanner.Text())
-		m, err := parseMetricLine(scanner.Text())
+		line := scanner.Text()
+		slog.Debug("command output", "output", line)
+		if p.Format == "prometheus" {
+			// skip HELP, TYPE and other comments
+			if l := strings.TrimSpace(line); l == "" || strings.HasPrefix(l, "#") {
+				continue
+			}
+		}
+		m, err := parse(line)
 		if err != nil {
 			slog.Warn("failed to parse metric line", "command", strings.Join(p.Command, " "), "error", err)
+			invalid++
 			continue
 		}
+		parsed++
 		if p.GraphDefs {
 			m.Name = CustomPrefix + m.Name
 		}
@@ -174,6 +270,9 @@ func (p *CommandProbe) Run(ctx context.Context) (ms Metrics, err error) {
 	}
 
 	err = cmd.Wait()
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
 	if e, ok := err.(*exec.ExitError); ok {
 		return ms, fmt.Errorf("command execute failed: %w", e)
 	}
@@ -247,13 +346,9 @@ func (p *CommandProbe) GetGraphDefs() (*GraphsOutput, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
-	cmd.Env = append(os.Environ(), "MACKEREL_AGENT_PLUGIN_META=1")
-	cmd.Cancel = func() error {
-		return cmd.Process.Signal(syscall.SIGTERM)
-	}
-	cmd.WaitDelay = 5 * time.Second // SIGKILL after 5 seconds
-	cmd.Stderr = os.Stderr
+	cmd := p.exec.command(ctx, p.Command[0], p.Command[1:], "command", strings.Join(p.Command, " "))
+	defer flushStderr(cmd)
+	cmd.Env = append(cmd.Env, "MACKEREL_AGENT_PLUGIN_META=1")
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, fmt.Errorf("stdout open failed: %w", err)
@@ -262,6 +357,11 @@ func (p *CommandProbe) GetGraphDefs() (*GraphsOutput, error) {
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("command execute failed: %w", err)
 	}
+	defer func() {
+		// drain the rest of the output not to block the command, and wait for it before flushing stderr
+		io.Copy(io.Discard, r)
+		cmd.Wait()
+	}()
 
 	header, err := r.ReadBytes('\n')
 	if err != nil {
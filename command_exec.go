@@ -0,0 +1,237 @@
+package maprobe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// commandStderrMaxLineLength is the max length of a line of stderr logged at once.
+const commandStderrMaxLineLength = 64 * 1024
+
+// CommandExecConfig represents how to execute commands of command and check probes.
+type CommandExecConfig struct {
+	WorkingDir   string         `yaml:"working_dir"`
+	User         string         `yaml:"user"`
+	Group        string         `yaml:"group"`
+	Rlimits      *RlimitsConfig `yaml:"rlimits"`
+	EnvAllowlist []string       `yaml:"env_allowlist"`
+}
+
+// RlimitsConfig represents resource limits for commands.
+type RlimitsConfig struct {
+	Memory    string        `yaml:"memory"`     // max size of the virtual memory (e.g. 512M)
+	CPUTime   time.Duration `yaml:"cpu_time"`   // max CPU time
+	OpenFiles uint64        `yaml:"open_files"` // max number of open files
+}
+
+// commandExec holds the resolved settings to execute commands.
+type commandExec struct {
+	workingDir   string
+	credential   *syscall.Credential
+	ulimits      []string
+	envAllowlist []string
+	logAttrs     []any
+}
+
+func (c *CommandExecConfig) newCommandExec(host *ProbeHost, env map[string]string) (*commandExec, error) {
+	e := &commandExec{
+		envAllowlist: c.EnvAllowlist,
+		logAttrs:     []any{"hostID", host.ID, "hostName", host.Name},
+	}
+	var err error
+
+	e.workingDir, err = expandPlaceHolder(c.WorkingDir, host, env)
+	if err != nil {
+		return nil, fmt.Errorf("invalid working_dir: %w", err)
+	}
+	for _, pattern := range e.envAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid env_allowlist pattern %s: %w", pattern, err)
+		}
+	}
+
+	if c.User != "" || c.Group != "" {
+		e.credential, err = newCredential(c.User, c.Group)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r := c.Rlimits; r != nil {
+		if r.Memory != "" {
+			size, err := parseByteSize(r.Memory)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rlimits.memory: %w", err)
+			}
+			// in KiB
+			e.ulimits = append(e.ulimits, fmt.Sprintf("ulimit -v %d", (size+1023)/1024))
+		}
+		if r.CPUTime > 0 {
+			e.ulimits = append(e.ulimits, fmt.Sprintf("ulimit -t %d", int64(math.Ceil(r.CPUTime.Seconds()))))
+		}
+		if r.OpenFiles > 0 {
+			e.ulimits = append(e.ulimits, fmt.Sprintf("ulimit -n %d", r.OpenFiles))
+		}
+	}
+	return e, nil
+}
+
+// newCredential resolves the user and the group to drop privileges.
+func newCredential(userName, groupName string) (*syscall.Credential, error) {
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+	if userName != "" {
+		u, err := lookupUser(userName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user: %w", err)
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+	if groupName != "" {
+		g, err := lookupGroup(groupName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group: %w", err)
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		cred.Gid = uint32(gid)
+	}
+	if os.Getuid() != 0 {
+		// only root can change supplementary groups
+		cred.NoSetGroups = true
+	}
+	return cred, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+// parseByteSize parses a size like "512M". K, M and G are powers of 1024.
+func parseByteSize(s string) (uint64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	unit := uint64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+// environ returns the environment variables of maprobe passed to commands.
+func (e *commandExec) environ() []string {
+	if e.envAllowlist == nil {
+		return os.Environ()
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, pattern := range e.envAllowlist {
+			if ok, _ := path.Match(pattern, name); ok {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// command returns a command which runs with the settings.
+// The standard error of the command is logged by slog.
+func (e *commandExec) command(ctx context.Context, name string, args []string, attrs ...any) *exec.Cmd {
+	if len(e.ulimits) > 0 {
+		// Go cannot set rlimits of child processes, so sh sets them and execs the command.
+		script := strings.Join(e.ulimits, " && ") + ` && exec "$@"`
+		args = append([]string{"-c", script, "sh", name}, args...)
+		name = "sh"
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = e.workingDir
+	if e.credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: e.credential}
+	}
+	cmd.Env = e.environ()
+	cmd.Stderr = &stderrLogger{attrs: append(append([]any{}, e.logAttrs...), attrs...)}
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 5 * time.Second // SIGKILL after 5 seconds
+	return cmd
+}
+
+// stderrLogger logs each line written as a structured log.
+type stderrLogger struct {
+	attrs []any
+	buf   []byte
+}
+
+func (w *stderrLogger) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= commandStderrMaxLineLength {
+		w.log(w.buf)
+		w.buf = nil
+	}
+	return len(b), nil
+}
+
+func (w *stderrLogger) log(line []byte) {
+	slog.Warn("command stderr", append([]any{"stderr", string(bytes.TrimRight(line, "\r"))}, w.attrs...)...)
+}
+
+// Flush logs the last line without a newline.
+func (w *stderrLogger) Flush() {
+	if len(w.buf) > 0 {
+		w.log(w.buf)
+		w.buf = nil
+	}
+}
+
+// flushStderr flushes the stderr logger of the command. It must be called after Wait.
+func flushStderr(cmd *exec.Cmd) {
+	if w, ok := cmd.Stderr.(*stderrLogger); ok {
+		w.Flush()
+	}
+}
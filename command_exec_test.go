@@ -0,0 +1,94 @@
+package maprobe_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestCommandExec(t *testing.T) {
+	t.Setenv("MAPROBE_TEST_ALLOWED", "yes")
+	t.Setenv("MAPROBE_DENIED", "yes")
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	c, _, err := maprobe.LoadConfig(context.Background(), "test/command_exec.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		"test.wd.test",
+		"test.env.yes.no.foo",
+		"test.limits.64.2.524288",
+		"test.stderr",
+	}
+	for i, pd := range c.Probes {
+		probe, err := pd.Command.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: "test-host"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms, err := probe.Run(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		if len(ms) != 1 || ms[0].Name != expects[i] {
+			t.Errorf("unexpected metrics %s, want %s", ms.String(), expects[i])
+		}
+	}
+
+	if !strings.Contains(logs.String(), `msg="command stderr" stderr="error message" hostID=test hostName=test-host`) {
+		t.Errorf("stderr is not logged: %s", logs.String())
+	}
+}
+
+func TestCommandExecUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to change user")
+	}
+	pc := &maprobe.CheckProbeConfig{
+		Name:       "check-user",
+		RawCommand: []interface{}{"id", "-u"},
+	}
+	pc.User = "65534"
+	c := &maprobe.Config{Probes: []*maprobe.ProbeDefinition{{Check: pc}}}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := probe.Run(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if r := probe.(maprobe.CheckReporter).CheckReport(); r.Message != "65534" {
+		t.Errorf("unexpected uid %s", r.Message)
+	}
+}
+
+func TestCommandExecInvalid(t *testing.T) {
+	configs := []maprobe.CommandExecConfig{
+		{User: "no-such-user-for-maprobe"},
+		{Group: "no-such-group-for-maprobe"},
+		{Rlimits: &maprobe.RlimitsConfig{Memory: "512X"}},
+		{EnvAllowlist: []string{"["}},
+	}
+	for _, ec := range configs {
+		pc := &maprobe.CheckProbeConfig{Name: "check", RawCommand: "true", CommandExecConfig: ec}
+		c := &maprobe.Config{Probes: []*maprobe.ProbeDefinition{{Check: pc}}}
+		if err := c.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", ec)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package maprobe_test
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -59,6 +61,30 @@ var commandProbesExpect = [][]maprobe.Metric{
 			},
 		},
 	},
+	{
+		{
+			Name:      "test.json.ok",
+			Value:     1,
+			Timestamp: time.Unix(1523261168, 0),
+			Attribute: &maprobe.Attribute{
+				Extra: map[string]string{
+					"attr_foo": "foo",
+				},
+			},
+		},
+	},
+	{
+		{
+			Name:      "test_prometheus_ok",
+			Value:     1,
+			Timestamp: time.Unix(1523261168, 0),
+			Attribute: &maprobe.Attribute{
+				Extra: map[string]string{
+					"attr_foo": "foo",
+				},
+			},
+		},
+	},
 }
 
 func TestCommand(t *testing.T) {
@@ -68,7 +94,7 @@ func TestCommand(t *testing.T) {
 		return
 	}
 	for i, p := range c.Probes {
-		probe, err := p.Command.GenerateProbe(&mackerel.Host{ID: "test"}, nil)
+		probe, err := p.Command.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}, nil)
 		if err != nil {
 			t.Error(err)
 		}
@@ -76,6 +102,10 @@ func TestCommand(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
+		if len(ms) != len(commandProbesExpect[i]) {
+			t.Errorf("unexpected metrics count %d: %s", len(ms), ms.String())
+			continue
+		}
 		for j, m := range ms {
 			expected := commandProbesExpect[i][j]
 			if d := cmp.Diff(m.String(), expected.String()); d != "" {
@@ -96,6 +126,23 @@ func TestCommandFail(t *testing.T) {
 	}
 }
 
+func TestCommandInvalidFormat(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "config.yaml")
+	conf := `
+probes:
+  - service: test
+    command:
+      command: "true"
+      format: xml
+`
+	if err := os.WriteFile(f, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := maprobe.LoadConfig(context.Background(), f); err == nil {
+		t.Error("must be failed for invalid format")
+	}
+}
+
 var ngInputs = []struct {
 	Title string
 	Line  string
@@ -126,3 +173,129 @@ func TestParseMetricLineNG(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandExecMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *maprobe.CommandProbeConfig
+		expectError bool
+		checks      map[string]float64
+	}{
+		{
+			name: "success",
+			config: &maprobe.CommandProbeConfig{
+				RawCommand:  "printf 'test.foo\t1\t1523261168\ninvalid\n'",
+				ExecMetrics: true,
+			},
+			checks: map[string]float64{
+				"command.exit_code":     0,
+				"command.lines.parsed":  1,
+				"command.lines.invalid": 1,
+			},
+		},
+		{
+			name: "exit code",
+			config: &maprobe.CommandProbeConfig{
+				RawCommand:          "exit 3",
+				ExecMetrics:         true,
+				ExecMetricKeyPrefix: "foo",
+			},
+			expectError: true,
+			checks: map[string]float64{
+				"foo.exit_code":     3,
+				"foo.lines.parsed":  0,
+				"foo.lines.invalid": 0,
+			},
+		},
+		{
+			name: "timeout",
+			config: &maprobe.CommandProbeConfig{
+				RawCommand:  []interface{}{"sleep", "3"},
+				Timeout:     100 * time.Millisecond,
+				ExecMetrics: true,
+			},
+			expectError: true,
+			checks: map[string]float64{
+				"command.exit_code": -1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &maprobe.Config{Probes: []*maprobe.ProbeDefinition{{Command: tt.config}}}
+			if err := c.Initialize(); err != nil {
+				t.Fatal(err)
+			}
+			probe, err := tt.config.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			found := map[string]bool{}
+			for _, m := range ms {
+				if v, ok := tt.checks[m.Name]; ok {
+					found[m.Name] = true
+					if m.Value != v {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, v)
+					}
+				}
+			}
+			for name := range tt.checks {
+				if !found[name] {
+					t.Errorf("metric %s not found", name)
+				}
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestCommandGetGraphDefs(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		expectError bool
+	}{
+		{
+			name:    "graph defs",
+			command: `printf '# mackerel-agent-plugin\n{"graphs":{"test":{"label":"Test","unit":"integer","metrics":[{"name":"ok","label":"OK"}]}}}\n'; echo done >&2`,
+		},
+		{
+			name:        "no header",
+			command:     `printf 'test.foo\t1\t1523261168\n'; seq 100000; echo done >&2`,
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &maprobe.CommandProbeConfig{RawCommand: tt.command}
+			c := &maprobe.Config{Probes: []*maprobe.ProbeDefinition{{Command: config}}}
+			if err := c.Initialize(); err != nil {
+				t.Fatal(err)
+			}
+			probe, err := config.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := probe.(*maprobe.CommandProbe).GetGraphDefs()
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g, ok := out.Graphs["test"]; !ok || g.Label != "Test" {
+				t.Errorf("unexpected graph defs %#v", out)
+			}
+		})
+	}
+}
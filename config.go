@@ -85,25 +85,59 @@ type ProbeDefinition struct {
 
 	IsServiceMetric bool `yaml:"service_metric"`
 
+	Targets *TargetsConfig `yaml:"targets"` // probe targets instead of Mackerel hosts
+
+	Include *HostFilterConfig `yaml:"include"`
+	Exclude *HostFilterConfig `yaml:"exclude"`
+
+	Metadata *MetadataConfig `yaml:"metadata"` // Mackerel metadata available in templates
+
 	Ping    *PingProbeConfig    `yaml:"ping"`
 	TCP     *TCPProbeConfig     `yaml:"tcp"`
+	UDP     *UDPProbeConfig     `yaml:"udp"`
 	HTTP    *HTTPProbeConfig    `yaml:"http"`
 	Command *CommandProbeConfig `yaml:"command"`
+	Check   *CheckProbeConfig   `yaml:"check"`
 	GRPC    *GRPCProbeConfig    `yaml:"grpc"`
+	DNS     *DNSProbeConfig     `yaml:"dns"`
+	TLS     *TLSProbeConfig     `yaml:"tls"`
+
+	Traceroute *TracerouteProbeConfig `yaml:"traceroute"`
+
+	HTTPScenario *HTTPScenarioProbeConfig `yaml:"http_scenario"`
 
 	Attributes map[string]string `yaml:"attributes"`
+
+	ScheduleConfig `yaml:",inline" json:"-"`
 }
 
 func (pd *ProbeDefinition) Validate() error {
+	if err := pd.validateMetadata(); err != nil {
+		return err
+	}
+	if pd.Targets != nil {
+		if len(pd.Roles) > 0 || len(pd.Statuses) > 0 {
+			return fmt.Errorf("probe for targets cannot have role or roles or statuses")
+		}
+		if pd.Check != nil {
+			return fmt.Errorf("probe for targets cannot have check, because check monitoring is reported for Mackerel hosts")
+		}
+	}
 	if pd.IsServiceMetric {
 		if pd.Role.Value != "" || len(pd.Roles) > 0 || len(pd.Statuses) > 0 {
 			return fmt.Errorf("probe for service metric cannot have role or roles or statuses")
 		}
+		if pd.Check != nil {
+			return fmt.Errorf("probe for service metric cannot have check, because check monitoring is reported for hosts")
+		}
+		if pd.Targets == nil && (pd.Include != nil || pd.Exclude != nil) {
+			return fmt.Errorf("probe for service metric cannot have include or exclude without targets")
+		}
 	}
 	return nil
 }
 
-func (pd *ProbeDefinition) GenerateProbes(host *mackerel.Host, client *mackerel.Client) []Probe {
+func (pd *ProbeDefinition) GenerateProbes(host *ProbeHost, client *mackerel.Client) []Probe {
 	var probes []Probe
 
 	if pingConfig := pd.Ping; pingConfig != nil {
@@ -124,6 +158,15 @@ func (pd *ProbeDefinition) GenerateProbes(host *mackerel.Host, client *mackerel.
 		}
 	}
 
+	if udpConfig := pd.UDP; udpConfig != nil {
+		p, err := udpConfig.GenerateProbe(host)
+		if err != nil {
+			slog.Error("cannot generate udp probe", "hostID", host.ID, "hostName", host.Name, "error", err)
+		} else {
+			probes = append(probes, p)
+		}
+	}
+
 	if httpConfig := pd.HTTP; httpConfig != nil {
 		p, err := httpConfig.GenerateProbe(host)
 		if err != nil {
@@ -142,6 +185,15 @@ func (pd *ProbeDefinition) GenerateProbes(host *mackerel.Host, client *mackerel.
 		}
 	}
 
+	if checkConfig := pd.Check; checkConfig != nil {
+		p, err := checkConfig.GenerateProbe(host)
+		if err != nil {
+			slog.Error("cannot generate check probe", "hostID", host.ID, "hostName", host.Name, "error", err)
+		} else {
+			probes = append(probes, p)
+		}
+	}
+
 	if grpcConfig := pd.GRPC; grpcConfig != nil {
 		p, err := grpcConfig.GenerateProbe(host)
 		if err != nil {
@@ -151,6 +203,42 @@ func (pd *ProbeDefinition) GenerateProbes(host *mackerel.Host, client *mackerel.
 		}
 	}
 
+	if dnsConfig := pd.DNS; dnsConfig != nil {
+		p, err := dnsConfig.GenerateProbe(host)
+		if err != nil {
+			slog.Error("cannot generate dns probe", "hostID", host.ID, "hostName", host.Name, "error", err)
+		} else {
+			probes = append(probes, p)
+		}
+	}
+
+	if tlsConfig := pd.TLS; tlsConfig != nil {
+		p, err := tlsConfig.GenerateProbe(host)
+		if err != nil {
+			slog.Error("cannot generate tls probe", "hostID", host.ID, "hostName", host.Name, "error", err)
+		} else {
+			probes = append(probes, p)
+		}
+	}
+
+	if tracerouteConfig := pd.Traceroute; tracerouteConfig != nil {
+		p, err := tracerouteConfig.GenerateProbe(host)
+		if err != nil {
+			slog.Error("cannot generate traceroute probe", "hostID", host.ID, "hostName", host.Name, "error", err)
+		} else {
+			probes = append(probes, p)
+		}
+	}
+
+	if httpScenarioConfig := pd.HTTPScenario; httpScenarioConfig != nil {
+		p, err := httpScenarioConfig.GenerateProbe(host)
+		if err != nil {
+			slog.Error("cannot generate http_scenario probe", "hostID", host.ID, "hostName", host.Name, "error", err)
+		} else {
+			probes = append(probes, p)
+		}
+	}
+
 	return probes
 }
 
@@ -193,6 +281,27 @@ func (c *Config) initialize() error {
 				return err
 			}
 		}
+		if pd.Check != nil {
+			if err := pd.Check.initialize(); err != nil {
+				return err
+			}
+		}
+		if pd.Targets != nil {
+			if err := pd.Targets.initialize(); err != nil {
+				return err
+			}
+		}
+		for _, f := range []*HostFilterConfig{pd.Include, pd.Exclude} {
+			if f == nil {
+				continue
+			}
+			if err := f.initialize(); err != nil {
+				return err
+			}
+		}
+		if err := pd.ScheduleConfig.initialize(); err != nil {
+			return err
+		}
 		if err := pd.Validate(); err != nil {
 			return err
 		}
@@ -201,6 +310,9 @@ func (c *Config) initialize() error {
 		if r := ad.Role.String(); r != "" {
 			ad.Roles = append(ad.Roles, ad.Role)
 		}
+		if err := ad.ScheduleConfig.initialize(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -211,6 +323,12 @@ func (c *Config) validate() error {
 		c.PostProbedMetrics = !*o
 	}
 
+	for i, pd := range c.Probes {
+		if pd.Targets != nil && !pd.IsServiceMetric && !c.Destination.Otel.Enabled {
+			slog.Warn("metrics of targets are posted to OpenTelemetry only, but destination.otel is not enabled", "probe", fmt.Sprintf("probes[%d]", i))
+		}
+	}
+
 	for _, ag := range c.Aggregates {
 		for _, mc := range ag.Metrics {
 			for _, oc := range mc.Outputs {
@@ -299,6 +417,8 @@ type AggregateDefinition struct {
 	Roles    []exString      `yaml:"roles"`
 	Statuses []exString      `yaml:"statuses"`
 	Metrics  []*MetricConfig `yaml:"metrics"`
+
+	ScheduleConfig `yaml:",inline" json:"-"`
 }
 
 type MetricConfig struct {
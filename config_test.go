@@ -51,6 +51,12 @@ var testConfigExpected = &Config{
 				Body:               `{"hello":"world"}`,
 				ExpectPattern:      "ok",
 				NoCheckCertificate: true,
+				TLSClientConfig: TLSClientConfig{
+					ClientCert: "/etc/maprobe/client.pem",
+					ClientKey:  "/etc/maprobe/client-key.pem",
+					CAFile:     "/etc/maprobe/ca.pem",
+					ServerName: "{{ .Host.Name }}.internal",
+				},
 			},
 		},
 		{
@@ -113,14 +119,14 @@ func TestConfig(t *testing.T) {
 		t.Error(err)
 	}
 	for i, p := range conf.Probes {
-		if diff := cmp.Diff(p, testConfigExpected.Probes[i]); diff != "" {
+		if diff := cmp.Diff(p, testConfigExpected.Probes[i], cmpopts.IgnoreUnexported(ScheduleConfig{})); diff != "" {
 			t.Errorf("unexpected probes %d\n%s", i, diff)
 		}
 	}
 
 	for i, a := range conf.Aggregates {
 		b := testConfigExpected.Aggregates[i]
-		opt := cmpopts.IgnoreUnexported(OutputConfig{})
+		opt := cmpopts.IgnoreUnexported(OutputConfig{}, ScheduleConfig{})
 		if diff := cmp.Diff(a, b, opt); diff != "" {
 			t.Errorf("unexpected aggregates %d\n%s", i, diff)
 		}
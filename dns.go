@@ -0,0 +1,207 @@
+package maprobe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	DefaultDNSTimeout         = 5 * time.Second
+	DefaultDNSPort            = "53"
+	DefaultDNSQueryType       = "A"
+	DefaultDNSMetricKeyPrefix = "dns"
+)
+
+var dnsQueryTypes = map[string]uint16{
+	"A":     dns.TypeA,
+	"AAAA":  dns.TypeAAAA,
+	"CNAME": dns.TypeCNAME,
+	"MX":    dns.TypeMX,
+	"TXT":   dns.TypeTXT,
+	"SRV":   dns.TypeSRV,
+	"SOA":   dns.TypeSOA,
+}
+
+type DNSProbeConfig struct {
+	Server          string        `yaml:"server"`
+	Port            string        `yaml:"port"`
+	Name            string        `yaml:"name"`
+	Type            string        `yaml:"type"`
+	TCP             bool          `yaml:"tcp"`
+	NoRecursion     bool          `yaml:"no_recursion"`
+	ExpectPattern   string        `yaml:"expect_pattern"`
+	Timeout         time.Duration `yaml:"timeout"`
+	MetricKeyPrefix string        `yaml:"metric_key_prefix"`
+}
+
+func (pc *DNSProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
+	p := &DNSProbe{
+		hostID:          host.ID,
+		metricKeyPrefix: pc.MetricKeyPrefix,
+		TCP:             pc.TCP,
+		NoRecursion:     pc.NoRecursion,
+		Timeout:         pc.Timeout,
+	}
+	var err error
+
+	p.Server, err = expandPlaceHolder(pc.Server, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server: %w", err)
+	}
+	if p.Server == "" {
+		return nil, fmt.Errorf("no server")
+	}
+
+	p.Port, err = expandPlaceHolder(pc.Port, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %w", err)
+	}
+
+	p.Name, err = expandPlaceHolder(pc.Name, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name: %w", err)
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("no name")
+	}
+
+	p.Type = strings.ToUpper(pc.Type)
+	if p.Type == "" {
+		p.Type = DefaultDNSQueryType
+	}
+	if _, ok := dnsQueryTypes[p.Type]; !ok {
+		return nil, fmt.Errorf("unsupported query type %s", pc.Type)
+	}
+
+	var pattern string
+	pattern, err = expandPlaceHolder(pc.ExpectPattern, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+	}
+	if pattern != "" {
+		p.ExpectPattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+		}
+	}
+
+	if p.Port == "" {
+		p.Port = DefaultDNSPort
+	}
+	if p.Timeout == 0 {
+		p.Timeout = DefaultDNSTimeout
+	}
+	if p.metricKeyPrefix == "" {
+		p.metricKeyPrefix = DefaultDNSMetricKeyPrefix
+	}
+
+	return p, nil
+}
+
+type DNSProbe struct {
+	hostID          string
+	metricKeyPrefix string
+
+	Server        string
+	Port          string
+	Name          string
+	Type          string
+	TCP           bool
+	NoRecursion   bool
+	ExpectPattern *regexp.Regexp
+	Timeout       time.Duration
+}
+
+func (p *DNSProbe) HostID() string {
+	return p.hostID
+}
+
+func (p *DNSProbe) MetricName(name string) string {
+	return p.metricKeyPrefix + "." + name
+}
+
+func (p *DNSProbe) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+func (p *DNSProbe) Run(ctx context.Context) (ms Metrics, err error) {
+	var ok bool
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, "elapsed.seconds", elapsed.Seconds()))
+		if ok {
+			ms = append(ms, newMetric(p, "check.ok", 1))
+		} else {
+			ms = append(ms, newMetric(p, "check.ok", 0))
+		}
+		slog.Debug("dns probe completed", "metrics", ms.String())
+	}()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(p.Name), dnsQueryTypes[p.Type])
+	msg.RecursionDesired = !p.NoRecursion
+
+	client := &dns.Client{Timeout: p.Timeout}
+	if p.TCP {
+		client.Net = "tcp"
+	}
+	addr := net.JoinHostPort(p.Server, p.Port)
+
+	slog.Debug("dns query", "server", addr, "name", p.Name, "type", p.Type, "net", client.Net)
+	resp, _, err := client.ExchangeContext(timeoutCtx, msg, addr)
+	if err != nil {
+		return ms, fmt.Errorf("query failed: %w", err)
+	}
+
+	ms = append(ms, newMetric(p, "rcode", float64(resp.Rcode)))
+	ms = append(ms, newMetric(p, "answer.count", float64(len(resp.Answer))))
+	for _, rr := range append(resp.Answer, resp.Ns...) {
+		if soa, isSOA := rr.(*dns.SOA); isSOA {
+			ms = append(ms, newMetric(p, "soa.serial", float64(soa.Serial)))
+			break
+		}
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		return ms, fmt.Errorf("unexpected rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Answer) == 0 {
+		return ms, fmt.Errorf("no answer")
+	}
+
+	if p.ExpectPattern != nil {
+		var matched bool
+		for _, rr := range resp.Answer {
+			value := dnsAnswerValue(rr)
+			slog.Debug("dns answer", "value", value)
+			if p.ExpectPattern.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ms, fmt.Errorf("unexpected response")
+		}
+	}
+
+	ok = true
+	return
+}
+
+// dnsAnswerValue returns the RDATA part of the resource record as a string.
+func dnsAnswerValue(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
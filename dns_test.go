@@ -0,0 +1,261 @@
+package maprobe_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+	"github.com/miekg/dns"
+)
+
+var DNSServerAddress string
+
+func init() {
+	DNSServerAddress = testDNSServer()
+}
+
+var testDNSRecords = []string{
+	"example.com. 300 IN A 192.0.2.1",
+	"example.com. 300 IN A 192.0.2.2",
+	"example.com. 300 IN MX 10 mail.example.com.",
+	"example.com. 300 IN TXT \"v=spf1 -all\"",
+	"example.com. 300 IN SOA ns.example.com. admin.example.com. 2024010101 3600 600 86400 300",
+	"www.example.com. 300 IN CNAME example.com.",
+	"_http._tcp.example.com. 300 IN SRV 10 5 8080 web1.example.com.",
+	"_http._tcp.example.com. 300 IN SRV 10 5 8081 web2.example.com.",
+	"web1.example.com. 300 IN A 192.0.2.11",
+	"web2.example.com. 300 IN A 192.0.2.12",
+	"web2.example.com. 300 IN AAAA 2001:db8::12",
+}
+
+func testDNSServer() string {
+	records := make([]dns.RR, 0, len(testDNSRecords))
+	for _, s := range testDNSRecords {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			panic(err)
+		}
+		records = append(records, rr)
+	}
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		var exists bool
+		for _, rr := range records {
+			if rr.Header().Name == q.Name {
+				exists = true
+				if rr.Header().Rrtype == q.Qtype {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+		}
+		if !exists {
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	// listen TCP on the same port as UDP
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		panic(err)
+	}
+	go (&dns.Server{PacketConn: pc, Handler: handler}).ActivateAndServe()
+	go (&dns.Server{Listener: l, Handler: handler}).ActivateAndServe()
+	return pc.LocalAddr().String()
+}
+
+func TestDNSProbe(t *testing.T) {
+	host, port, _ := net.SplitHostPort(DNSServerAddress)
+	tests := []struct {
+		name        string
+		config      *maprobe.DNSProbeConfig
+		expectError bool
+		expectOK    float64
+		answers     float64
+		soaSerial   float64
+	}{
+		{
+			name: "A record",
+			config: &maprobe.DNSProbeConfig{
+				Server:        "{{ .Host.Name }}",
+				Port:          port,
+				Name:          "example.com",
+				ExpectPattern: `^192\.0\.2\.2$`,
+			},
+			expectOK: 1,
+			answers:  2,
+		},
+		{
+			name: "A record over TCP",
+			config: &maprobe.DNSProbeConfig{
+				Server: "{{ .Host.Name }}",
+				Port:   port,
+				Name:   "example.com",
+				TCP:    true,
+			},
+			expectOK: 1,
+			answers:  2,
+		},
+		{
+			name: "MX record",
+			config: &maprobe.DNSProbeConfig{
+				Server:        "{{ .Host.Name }}",
+				Port:          port,
+				Name:          "example.com",
+				Type:          "mx",
+				ExpectPattern: `mail\.example\.com\.$`,
+			},
+			expectOK: 1,
+			answers:  1,
+		},
+		{
+			name: "CNAME record",
+			config: &maprobe.DNSProbeConfig{
+				Server: "{{ .Host.Name }}",
+				Port:   port,
+				Name:   "www.example.com",
+				Type:   "CNAME",
+			},
+			expectOK: 1,
+			answers:  1,
+		},
+		{
+			name: "SOA record",
+			config: &maprobe.DNSProbeConfig{
+				Server: "{{ .Host.Name }}",
+				Port:   port,
+				Name:   "example.com",
+				Type:   "SOA",
+			},
+			expectOK:  1,
+			answers:   1,
+			soaSerial: 2024010101,
+		},
+		{
+			name: "unexpected answer",
+			config: &maprobe.DNSProbeConfig{
+				Server:        "{{ .Host.Name }}",
+				Port:          port,
+				Name:          "example.com",
+				ExpectPattern: `^198\.51\.100\.1$`,
+			},
+			expectError: true,
+			expectOK:    0,
+			answers:     2,
+		},
+		{
+			name: "no answer",
+			config: &maprobe.DNSProbeConfig{
+				Server: "{{ .Host.Name }}",
+				Port:   port,
+				Name:   "example.com",
+				Type:   "AAAA",
+			},
+			expectError: true,
+			expectOK:    0,
+		},
+		{
+			name: "NXDOMAIN",
+			config: &maprobe.DNSProbeConfig{
+				Server: "{{ .Host.Name }}",
+				Port:   port,
+				Name:   "notfound.example.com",
+			},
+			expectError: true,
+			expectOK:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe, err := tt.config.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: host}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			var foundSOASerial bool
+			for _, m := range ms {
+				switch m.Name {
+				case "dns.check.ok":
+					if m.Value != tt.expectOK {
+						t.Errorf("unexpected check.ok %f", m.Value)
+					}
+				case "dns.answer.count":
+					if m.Value != tt.answers {
+						t.Errorf("unexpected answer.count %f", m.Value)
+					}
+				case "dns.soa.serial":
+					foundSOASerial = true
+					if m.Value != tt.soaSerial {
+						t.Errorf("unexpected soa.serial %f", m.Value)
+					}
+				case "dns.elapsed.seconds":
+					if m.Value <= 0 || m.Value > 1 {
+						t.Errorf("unexpected elapsed.seconds %f", m.Value)
+					}
+				}
+			}
+			if tt.soaSerial != 0 && !foundSOASerial {
+				t.Error("soa.serial metric not found")
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestDNSProbeTimeout(t *testing.T) {
+	// no DNS server listens on this port
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	host, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+
+	probe, err := (&maprobe.DNSProbeConfig{
+		Server:  host,
+		Port:    port,
+		Name:    "example.com",
+		Timeout: 100 * time.Millisecond,
+	}).GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := probe.Run(context.Background())
+	if err == nil {
+		t.Error("expected error, but got nil")
+	}
+	if len(ms) != 2 {
+		t.Errorf("unexpected metrics num: got %d, want 2", len(ms))
+	}
+}
+
+func TestDNSProbeConfigInvalid(t *testing.T) {
+	configs := []*maprobe.DNSProbeConfig{
+		{Name: "example.com"},
+		{Server: "127.0.0.1"},
+		{Server: "127.0.0.1", Name: "example.com", Type: "PTR"},
+		{Server: "127.0.0.1", Name: "example.com", ExpectPattern: "("},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}
@@ -1,7 +1,106 @@
 package maprobe
 
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
 var (
-	ParseMetricLine = parseMetricLine
-	DoRetry         = doRetry
-	NewClient       = newClient
+	ParseMetricLine           = parseMetricLine
+	ParseJSONMetricLine       = parseJSONMetricLine
+	ParsePrometheusMetricLine = parsePrometheusMetricLine
+	DoRetry                   = doRetry
+	NewClient                 = newClient
+	TracerouteChanged         = tracerouteChanged
+	SwapTraceroutePath        = swapTraceroutePath
 )
+
+func (c *Config) Initialize() error {
+	return c.initialize()
+}
+
+func (s *ScheduleConfig) Initialize() error {
+	return s.initialize()
+}
+
+func (s *ScheduleConfig) First(now time.Time) time.Time {
+	return s.first(now)
+}
+
+func (s *ScheduleConfig) Next(prev, now time.Time) time.Time {
+	return s.next(prev, now)
+}
+
+func (s *ScheduleConfig) RunDeadline(start, next time.Time) time.Time {
+	return s.deadline(start, next)
+}
+
+func (s *ScheduleConfig) OnceDeadline(start time.Time) time.Time {
+	return s.onceDeadline(start)
+}
+
+func (tc *TargetsConfig) FindHosts() ([]*ProbeHost, error) {
+	return tc.findHosts(context.Background())
+}
+
+func NewTestClient(baseURL string) *Client {
+	c, _ := mackerel.NewClientWithOptions("dummy", baseURL, false)
+	return &Client{mackerel: c}
+}
+
+func (pd *ProbeDefinition) FilterHosts(hosts []*mackerel.Host, client *Client) []*mackerel.Host {
+	var filtered []*mackerel.Host
+	for _, host := range hosts {
+		if pd.filterHost(&ProbeHost{Host: host}, client) {
+			filtered = append(filtered, host)
+		}
+	}
+	return filtered
+}
+
+func NewRedactHandler(h slog.Handler) slog.Handler {
+	return &redactHandler{Handler: h}
+}
+
+func TraceroutePathsLen() int {
+	n := 0
+	traceroutePaths.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func ResetTraceroutePathsPurged() {
+	traceroutePathsPurged.Store(0)
+}
+
+type Job = job
+
+func NewJobs(conf *Config, now time.Time, prev []*Job) []*Job {
+	return newJobs(conf, nil, nil, nil, now, prev)
+}
+
+func (j *job) Name() string {
+	return j.name
+}
+
+func (j *job) NextRun() time.Time {
+	return j.next
+}
+
+func (j *job) Running() *atomic.Bool {
+	return j.running
+}
+
+func ProbeExecutionAttributes(probe Probe, err error) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range probeExecutionAttributes(probe, err) {
+		attrs[string(kv.Key)] = kv.Value.AsString()
+	}
+	return attrs
+}
@@ -0,0 +1,158 @@
+package maprobe
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// ExtractConfig defines how to extract a value from a response body.
+type ExtractConfig struct {
+	Name   string `yaml:"name"`
+	JQ     string `yaml:"jq"`
+	Regexp string `yaml:"regexp"`
+}
+
+func (ec *ExtractConfig) newExtractor(host *ProbeHost) (*extractor, error) {
+	if ec.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	e := &extractor{Name: ec.Name}
+	switch {
+	case ec.JQ != "" && ec.Regexp != "":
+		return nil, fmt.Errorf("%s: jq and regexp are exclusive", ec.Name)
+	case ec.JQ != "":
+		q, err := gojq.Parse(ec.JQ)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid jq: %w", ec.Name, err)
+		}
+		e.query, err = gojq.Compile(q)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid jq: %w", ec.Name, err)
+		}
+		e.Expr = ec.JQ
+	case ec.Regexp != "":
+		pattern, err := expandPlaceHolder(ec.Regexp, host, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid regexp: %w", ec.Name, err)
+		}
+		e.re, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid regexp: %w", ec.Name, err)
+		}
+		e.Expr = pattern
+	default:
+		return nil, fmt.Errorf("%s: jq or regexp is required", ec.Name)
+	}
+	return e, nil
+}
+
+func newExtractors(ecs []*ExtractConfig, host *ProbeHost) ([]*extractor, error) {
+	es := make([]*extractor, 0, len(ecs))
+	for _, ec := range ecs {
+		e, err := ec.newExtractor(host)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+type extractor struct {
+	Name string
+	Expr string
+
+	query *gojq.Code
+	re    *regexp.Regexp
+}
+
+// extractSource holds a response body and its JSON representation parsed lazily.
+type extractSource struct {
+	body   []byte
+	parsed bool
+	doc    any
+	err    error
+}
+
+func newExtractSource(body []byte) *extractSource {
+	return &extractSource{body: body}
+}
+
+func (s *extractSource) JSON() (any, error) {
+	if !s.parsed {
+		s.parsed = true
+		s.err = json.Unmarshal(s.body, &s.doc)
+	}
+	return s.doc, s.err
+}
+
+// Extract returns the first value extracted from the source.
+// For jq, it is the first result of the query. For regexp, it is the first
+// capture group (or the whole match when the pattern has no groups).
+func (e *extractor) Extract(src *extractSource) (any, error) {
+	if e.re != nil {
+		m := e.re.FindSubmatch(src.body)
+		if m == nil {
+			return nil, fmt.Errorf("%s: regexp %s does not match", e.Name, e.Expr)
+		}
+		if len(m) > 1 {
+			return string(m[1]), nil
+		}
+		return string(m[0]), nil
+	}
+
+	doc, err := src.JSON()
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid JSON: %w", e.Name, err)
+	}
+	iter := e.query.Run(doc)
+	v, ok := iter.Next()
+	if !ok || v == nil {
+		return nil, fmt.Errorf("%s: jq %s returns no value", e.Name, e.Expr)
+	}
+	if err, ok := v.(error); ok {
+		return nil, fmt.Errorf("%s: jq %s failed: %w", e.Name, e.Expr, err)
+	}
+	return v, nil
+}
+
+// ExtractFloat returns the first value extracted from the source as float64.
+func (e *extractor) ExtractFloat(src *extractSource) (float64, error) {
+	v, err := e.Extract(src)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return 0, fmt.Errorf("%s: %v is not a number", e.Name, v)
+	}
+	return f, nil
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -1,20 +1,23 @@
 package maprobe
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"regexp"
 	"time"
 
-	mackerel "github.com/mackerelio/mackerel-client-go"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 var (
@@ -30,9 +33,18 @@ type GRPCProbeConfig struct {
 	NoCheckCertificate bool              `yaml:"no_check_certificate"`
 	Metadata           map[string]string `yaml:"metadata"`
 	MetricKeyPrefix    string            `yaml:"metric_key_prefix"`
+
+	// Method invokes an arbitrary unary method instead of the health check.
+	Method        string           `yaml:"method"`
+	Request       string           `yaml:"request"`
+	DescriptorSet string           `yaml:"descriptor_set"`
+	ExpectPattern string           `yaml:"expect_pattern"`
+	Extract       []*ExtractConfig `yaml:"extract"`
+
+	TLSClientConfig `yaml:",inline"`
 }
 
-func (pc *GRPCProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
+func (pc *GRPCProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
 	p := &GRPCProbe{
 		hostID:             host.ID,
 		metricKeyPrefix:    pc.MetricKeyPrefix,
@@ -43,6 +55,11 @@ func (pc *GRPCProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 	}
 	var err error
 
+	p.TLSClientConfig, err = pc.TLSClientConfig.expand(host)
+	if err != nil {
+		return nil, err
+	}
+
 	p.Address, err = expandPlaceHolder(pc.Address, host, nil)
 	if err != nil {
 		return nil, fmt.Errorf("invalid address: %w", err)
@@ -53,6 +70,50 @@ func (pc *GRPCProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 		return nil, fmt.Errorf("invalid grpc_service: %w", err)
 	}
 
+	p.Method, err = expandPlaceHolder(pc.Method, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid method: %w", err)
+	}
+	if p.Method != "" {
+		if _, _, err := splitGRPCMethod(p.Method); err != nil {
+			return nil, fmt.Errorf("invalid method: %w", err)
+		}
+		if p.GRPCService != "" {
+			return nil, fmt.Errorf("method and grpc_service are exclusive")
+		}
+	} else if pc.Request != "" || pc.DescriptorSet != "" || pc.ExpectPattern != "" || len(pc.Extract) > 0 {
+		return nil, fmt.Errorf("request, descriptor_set, expect_pattern and extract require method")
+	}
+
+	p.Request, err = expandPlaceHolder(pc.Request, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if p.Method != "" && p.Request == "" {
+		p.Request = "{}"
+	}
+
+	p.DescriptorSet, err = expandPlaceHolder(pc.DescriptorSet, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor_set: %w", err)
+	}
+
+	pattern, err := expandPlaceHolder(pc.ExpectPattern, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+	}
+	if pattern != "" {
+		p.ExpectPattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+		}
+	}
+
+	p.Extractors, err = newExtractors(pc.Extract, host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extract: %w", err)
+	}
+
 	for key, value := range pc.Metadata {
 		p.Metadata[key], err = expandPlaceHolder(value, host, nil)
 		if err != nil {
@@ -80,6 +141,12 @@ type GRPCProbe struct {
 	TLS                bool
 	NoCheckCertificate bool
 	Metadata           map[string]string
+	Method             string
+	Request            string
+	DescriptorSet      string
+	ExpectPattern      *regexp.Regexp
+	Extractors         []*extractor
+	TLSClientConfig
 }
 
 func (p *GRPCProbe) HostID() string {
@@ -116,13 +183,11 @@ func (p *GRPCProbe) Run(ctx context.Context) (ms Metrics, err error) {
 	// Set up gRPC connection options
 	var opts []grpc.DialOption
 	if p.TLS {
-		if p.NoCheckCertificate {
-			config := &tls.Config{InsecureSkipVerify: true}
-			creds := credentials.NewTLS(config)
-			opts = append(opts, grpc.WithTransportCredentials(creds))
-		} else {
-			opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+		config, err := p.TLSClientConfig.newTLSConfig(p.NoCheckCertificate)
+		if err != nil {
+			return ms, err
 		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
 	} else {
 		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	}
@@ -142,6 +207,15 @@ func (p *GRPCProbe) Run(ctx context.Context) (ms Metrics, err error) {
 
 	slog.Debug("connected", "address", p.Address)
 
+	if p.Method != "" {
+		ms, err = p.invoke(timeoutCtx, conn, ms)
+		if err != nil {
+			return ms, err
+		}
+		ok = true
+		return
+	}
+
 	// Create health check client
 	healthClient := healthpb.NewHealthClient(conn)
 
@@ -166,18 +240,7 @@ func (p *GRPCProbe) Run(ctx context.Context) (ms Metrics, err error) {
 		}
 		return ms, fmt.Errorf("health check failed: %w", err)
 	}
-	slog.Debug("peer", "info", pe.String())
-	if pe.AuthInfo != nil {
-		// Add certificate expiration metric for TLS connections
-		if tlsInfo, ok := pe.AuthInfo.(credentials.TLSInfo); ok {
-			if len(tlsInfo.State.PeerCertificates) > 0 {
-				cert := tlsInfo.State.PeerCertificates[0]
-				expiresInDays := time.Until(cert.NotAfter).Hours() / 24
-				ms = append(ms, newMetric(p, "certificate.expires_in_days", expiresInDays))
-				slog.Debug("certificate expiration", "expires_at", cert.NotAfter, "expires_in_days", expiresInDays)
-			}
-		}
-	}
+	ms = append(ms, p.certificateMetrics(&pe)...)
 
 	// Add status code (0 = OK)
 	ms = append(ms, newMetric(p, "status.code", 0))
@@ -190,3 +253,71 @@ func (p *GRPCProbe) Run(ctx context.Context) (ms Metrics, err error) {
 	ok = true
 	return
 }
+
+// certificateMetrics returns the certificate expiration metric for TLS connections.
+func (p *GRPCProbe) certificateMetrics(pe *peer.Peer) Metrics {
+	slog.Debug("peer", "info", pe.String())
+	if pe.AuthInfo == nil {
+		return nil
+	}
+	tlsInfo, ok := pe.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := tlsInfo.State.PeerCertificates[0]
+	expiresInDays := time.Until(cert.NotAfter).Hours() / 24
+	slog.Debug("certificate expiration", "expires_at", cert.NotAfter, "expires_in_days", expiresInDays)
+	return Metrics{newMetric(p, "certificate.expires_in_days", expiresInDays)}
+}
+
+// invoke invokes the unary method with the JSON request, and checks the JSON-encoded response.
+// The metrics are appended to ms. check.ok is set by the caller (Run).
+func (p *GRPCProbe) invoke(ctx context.Context, conn *grpc.ClientConn, ms Metrics) (Metrics, error) {
+	md, err := resolveGRPCMethod(ctx, conn, p.Method, p.DescriptorSet)
+	if err != nil {
+		return ms, fmt.Errorf("failed to resolve method %s: %w", p.Method, err)
+	}
+	req := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal([]byte(p.Request), req); err != nil {
+		return ms, fmt.Errorf("invalid request: %w", err)
+	}
+	resp := dynamicpb.NewMessage(md.Output())
+
+	var pe peer.Peer
+	fullMethod := "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+	slog.Debug("invoke", "method", fullMethod)
+	if err := conn.Invoke(ctx, fullMethod, req, resp, grpc.Peer(&pe)); err != nil {
+		if st, ok := status.FromError(err); ok {
+			ms = append(ms, newMetric(p, "status.code", float64(st.Code())))
+		}
+		return ms, fmt.Errorf("invoke %s failed: %w", fullMethod, err)
+	}
+	ms = append(ms, p.certificateMetrics(&pe)...)
+	ms = append(ms, newMetric(p, "status.code", 0))
+
+	b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp)
+	if err != nil {
+		return ms, fmt.Errorf("failed to encode response: %w", err)
+	}
+	// protojson output is unstable in whitespace, so compact it for expect_pattern
+	var body bytes.Buffer
+	if err := json.Compact(&body, b); err != nil {
+		return ms, fmt.Errorf("failed to encode response: %w", err)
+	}
+	slog.Debug("response", "body", body.String())
+
+	src := newExtractSource(body.Bytes())
+	for _, e := range p.Extractors {
+		v, err := e.ExtractFloat(src)
+		if err != nil {
+			slog.Warn("failed to extract value from gRPC response", "method", fullMethod, "error", err)
+			continue
+		}
+		ms = append(ms, newMetric(p, e.Name, v))
+	}
+
+	if p.ExpectPattern != nil && !p.ExpectPattern.Match(body.Bytes()) {
+		return ms, fmt.Errorf("unexpected response")
+	}
+	return ms, nil
+}
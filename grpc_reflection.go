@@ -0,0 +1,176 @@
+package maprobe
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// splitGRPCMethod splits a full method name "package.Service/Method" into the service and the method.
+func splitGRPCMethod(fullMethod string) (string, string, error) {
+	service, method, found := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !found || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", fmt.Errorf("method must be package.Service/Method: %s", fullMethod)
+	}
+	return service, method, nil
+}
+
+// resolveGRPCMethod resolves the method descriptor from the descriptor set file,
+// or by the server reflection when descriptorSet is empty.
+func resolveGRPCMethod(ctx context.Context, conn *grpc.ClientConn, fullMethod, descriptorSet string) (protoreflect.MethodDescriptor, error) {
+	service, method, err := splitGRPCMethod(fullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	var fds map[string]*descriptorpb.FileDescriptorProto
+	if descriptorSet != "" {
+		fds, err = loadDescriptorSet(descriptorSet)
+	} else {
+		fds, err = fetchFileDescriptors(ctx, conn, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	files, err := newProtoFiles(fds)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found in %s", method, service)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s is not unary", fullMethod)
+	}
+	return md, nil
+}
+
+// loadDescriptorSet loads a FileDescriptorSet generated by `protoc --descriptor_set_out`.
+func loadDescriptorSet(path string) (map[string]*descriptorpb.FileDescriptorProto, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %s: %w", path, err)
+	}
+	fds := make(map[string]*descriptorpb.FileDescriptorProto, len(set.File))
+	for _, fd := range set.File {
+		fds[fd.GetName()] = fd
+	}
+	return fds, nil
+}
+
+// fetchFileDescriptors fetches the file descriptors which define the service
+// and its dependencies by the server reflection.
+func fetchFileDescriptors(ctx context.Context, conn *grpc.ClientConn, service string) (map[string]*descriptorpb.FileDescriptorProto, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed: %w", err)
+	}
+	defer stream.CloseSend()
+
+	fds := make(map[string]*descriptorpb.FileDescriptorProto)
+	requested := make(map[string]bool)
+	pending := []*rpb.ServerReflectionRequest{{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}}
+	for len(pending) > 0 {
+		req := pending[0]
+		pending = pending[1:]
+		if err := stream.Send(req); err != nil {
+			return nil, fmt.Errorf("server reflection failed: %w", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("server reflection failed: %w", err)
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection failed: %s", e.GetErrorMessage())
+		}
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return nil, fmt.Errorf("invalid file descriptor: %w", err)
+			}
+			fds[fd.GetName()] = fd
+		}
+		// request dependencies which are not sent by the server
+		for _, fd := range fds {
+			for _, dep := range fd.GetDependency() {
+				if _, found := fds[dep]; found || requested[dep] {
+					continue
+				}
+				if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					continue
+				}
+				requested[dep] = true
+				pending = append(pending, &rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				})
+			}
+		}
+	}
+	return fds, nil
+}
+
+// newProtoFiles builds a registry of the file descriptors.
+// Dependencies not included (e.g. well-known types) are taken from the global registry.
+func newProtoFiles(fds map[string]*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	added := make(map[string]bool)
+	var add func(fd *descriptorpb.FileDescriptorProto) error
+	add = func(fd *descriptorpb.FileDescriptorProto) error {
+		if added[fd.GetName()] {
+			return nil
+		}
+		added[fd.GetName()] = true
+		for _, dep := range fd.GetDependency() {
+			if d, found := fds[dep]; found {
+				if err := add(d); err != nil {
+					return err
+				}
+				continue
+			}
+			f, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+			if err != nil {
+				return fmt.Errorf("dependency %s of %s not found", dep, fd.GetName())
+			}
+			if err := add(protodesc.ToFileDescriptorProto(f)); err != nil {
+				return err
+			}
+		}
+		set.File = append(set.File, fd)
+		return nil
+	}
+	for _, fd := range fds {
+		if err := add(fd); err != nil {
+			return nil, err
+		}
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file descriptors: %w", err)
+	}
+	return files, nil
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -16,7 +18,11 @@ import (
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 var (
@@ -218,7 +224,7 @@ func TestGRPCProbe(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			probe, err := tt.config.GenerateProbe(&mackerel.Host{ID: "test", Name: "testhost"})
+			probe, err := tt.config.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: "testhost"}})
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -295,11 +301,11 @@ func TestGRPCProbeExpansion(t *testing.T) {
 		},
 	}
 
-	host := &mackerel.Host{
+	host := &maprobe.ProbeHost{Host: &mackerel.Host{
 		ID:               "12345",
 		Name:             "127.0.0.1",
 		CustomIdentifier: "test.service",
-	}
+	}}
 
 	probe, err := pc.GenerateProbe(host)
 	if err != nil {
@@ -319,3 +325,158 @@ func TestGRPCProbeExpansion(t *testing.T) {
 		t.Errorf("metadata not expanded correctly: got %s, want %s", grpcProbe.Metadata["host-id"], host.ID)
 	}
 }
+
+func TestGRPCProbeMethod(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, setupHealthServer())
+	reflection.Register(s)
+	go s.Serve(l)
+	defer s.Stop()
+
+	// descriptor set for the server without reflection
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptorSet := filepath.Join(t.TempDir(), "health.pb")
+	if err := os.WriteFile(descriptorSet, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		config      maprobe.GRPCProbeConfig
+		expectError bool
+		checks      map[string]float64
+	}{
+		{
+			name: "reflection",
+			config: maprobe.GRPCProbeConfig{
+				Address:       l.Addr().String(),
+				Method:        "grpc.health.v1.Health/Check",
+				Request:       `{"service":"{{ .Host.Name }}"}`,
+				ExpectPattern: `"status":"SERVING"`,
+				Extract: []*maprobe.ExtractConfig{
+					{Name: "serving", JQ: `.status == "SERVING"`},
+				},
+			},
+			checks: map[string]float64{
+				"grpc.check.ok":    1,
+				"grpc.status.code": 0,
+				"grpc.serving":     1,
+			},
+		},
+		{
+			name: "descriptor set",
+			config: maprobe.GRPCProbeConfig{
+				Address:       GRPCServerAddress,
+				Method:        "/grpc.health.v1.Health/Check",
+				DescriptorSet: descriptorSet,
+				ExpectPattern: `"status":"SERVING"`,
+			},
+			checks: map[string]float64{"grpc.check.ok": 1},
+		},
+		{
+			name: "unexpected response",
+			config: maprobe.GRPCProbeConfig{
+				Address:       l.Addr().String(),
+				Method:        "grpc.health.v1.Health/Check",
+				Request:       `{"service":"unhealthy.service"}`,
+				ExpectPattern: `"status":"SERVING"`,
+			},
+			expectError: true,
+			checks:      map[string]float64{"grpc.check.ok": 0, "grpc.status.code": 0},
+		},
+		{
+			name: "error status",
+			config: maprobe.GRPCProbeConfig{
+				Address: l.Addr().String(),
+				Method:  "grpc.health.v1.Health/Check",
+				Request: `{"service":"unknown.service"}`,
+			},
+			expectError: true,
+			checks:      map[string]float64{"grpc.check.ok": 0, "grpc.status.code": float64(codes.NotFound)},
+		},
+		{
+			name: "unknown method",
+			config: maprobe.GRPCProbeConfig{
+				Address: l.Addr().String(),
+				Method:  "grpc.health.v1.Health/Unknown",
+			},
+			expectError: true,
+			checks:      map[string]float64{"grpc.check.ok": 0},
+		},
+		{
+			name: "streaming method",
+			config: maprobe.GRPCProbeConfig{
+				Address: l.Addr().String(),
+				Method:  "grpc.health.v1.Health/Watch",
+			},
+			expectError: true,
+			checks:      map[string]float64{"grpc.check.ok": 0},
+		},
+		{
+			name: "no reflection",
+			config: maprobe.GRPCProbeConfig{
+				Address: GRPCServerAddress,
+				Method:  "grpc.health.v1.Health/Check",
+			},
+			expectError: true,
+			checks:      map[string]float64{"grpc.check.ok": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := tt.config
+			pc.Timeout = 3 * time.Second
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: "test.service"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			found := map[string]bool{}
+			for _, m := range ms {
+				if v, ok := tt.checks[m.Name]; ok {
+					found[m.Name] = true
+					if m.Value != v {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, v)
+					}
+				}
+			}
+			for name := range tt.checks {
+				if !found[name] {
+					t.Errorf("metric %s not found", name)
+				}
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestGRPCProbeMethodInvalid(t *testing.T) {
+	configs := []*maprobe.GRPCProbeConfig{
+		{Address: "localhost:50051", Method: "Check"},
+		{Address: "localhost:50051", Method: "grpc.health.v1.Health/Check", GRPCService: "test.service"},
+		{Address: "localhost:50051", Request: "{}"},
+		{Address: "localhost:50051", Method: "grpc.health.v1.Health/Check", ExpectPattern: "("},
+		{Address: "localhost:50051", Method: "grpc.health.v1.Health/Check", Extract: []*maprobe.ExtractConfig{{Name: "x"}}},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}
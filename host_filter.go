@@ -0,0 +1,149 @@
+package maprobe
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// HostFilterConfig represents conditions of hosts evaluated after finding hosts.
+// A host matches the filter when the host matches all of the conditions.
+type HostFilterConfig struct {
+	Name             string            `yaml:"name"`              // regexp of the host name
+	CustomIdentifier string            `yaml:"custom_identifier"` // regexp of the custom identifier
+	Interface        string            `yaml:"interface"`         // name of an interface which the host has
+	Metadata         map[string]string `yaml:"metadata"`          // namespace[.key...] -> regexp of the host metadata value
+
+	name             *regexp.Regexp
+	customIdentifier *regexp.Regexp
+	metadata         map[string]*regexp.Regexp
+}
+
+func (f *HostFilterConfig) initialize() error {
+	if f.Name == "" && f.CustomIdentifier == "" && f.Interface == "" && len(f.Metadata) == 0 {
+		return fmt.Errorf("host filter has no conditions")
+	}
+	var err error
+	if f.Name != "" {
+		if f.name, err = regexp.Compile(f.Name); err != nil {
+			return fmt.Errorf("invalid host filter name: %w", err)
+		}
+	}
+	if f.CustomIdentifier != "" {
+		if f.customIdentifier, err = regexp.Compile(f.CustomIdentifier); err != nil {
+			return fmt.Errorf("invalid host filter custom_identifier: %w", err)
+		}
+	}
+	f.metadata = make(map[string]*regexp.Regexp, len(f.Metadata))
+	for key, pattern := range f.Metadata {
+		if ns, _, _ := strings.Cut(key, "."); ns == "" {
+			return fmt.Errorf("invalid host filter metadata key %q", key)
+		}
+		if f.metadata[key], err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid host filter metadata %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// match reports whether the host matches the filter.
+// It returns an error when the host metadata cannot be fetched.
+func (f *HostFilterConfig) match(host *ProbeHost, client *Client) (bool, error) {
+	if f.name != nil && !f.name.MatchString(host.Name) {
+		return false, nil
+	}
+	if f.customIdentifier != nil && !f.customIdentifier.MatchString(host.CustomIdentifier) {
+		return false, nil
+	}
+	if f.Interface != "" {
+		var found bool
+		for _, iface := range host.Interfaces {
+			if iface.Name == f.Interface {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	fetched := make(map[string]any, len(f.metadata)) // namespace -> metadata
+	for key, re := range f.metadata {
+		if host.Target != nil {
+			// targets have no Mackerel host metadata
+			return false, nil
+		}
+		ns, path, _ := strings.Cut(key, ".")
+		metadata, ok := fetched[ns]
+		if !ok {
+			var err error
+			if metadata, err = client.GetHostMetadata(host.ID, ns); err != nil {
+				return false, err
+			}
+			fetched[ns] = metadata
+		}
+		v, ok := lookupMetadata(metadata, path)
+		if !ok || !re.MatchString(v) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lookupMetadata returns the string of the value at the dot separated path in the metadata.
+func lookupMetadata(metadata any, path string) (string, bool) {
+	if metadata == nil {
+		return "", false
+	}
+	v := metadata
+	if path != "" {
+		for _, k := range strings.Split(path, ".") {
+			m, ok := v.(map[string]any)
+			if !ok {
+				return "", false
+			}
+			if v, ok = m[k]; !ok {
+				return "", false
+			}
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	default:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+}
+
+// filterHost reports whether the host matches the include filter and does not match the exclude filter.
+// When the host metadata cannot be fetched, the host is not probed even for the exclude filter.
+func (pd *ProbeDefinition) filterHost(host *ProbeHost, client *Client) bool {
+	if pd.Include != nil {
+		matched, err := pd.Include.match(host, client)
+		if err != nil {
+			slog.Warn("host filter cannot get host metadata, skipping the host", "hostID", host.ID, "hostName", host.Name, "error", err)
+			return false
+		}
+		if !matched {
+			slog.Debug("host is not included", "hostID", host.ID, "hostName", host.Name)
+			return false
+		}
+	}
+	if pd.Exclude != nil {
+		matched, err := pd.Exclude.match(host, client)
+		if err != nil {
+			slog.Warn("host filter cannot get host metadata, skipping the host", "hostID", host.ID, "hostName", host.Name, "error", err)
+			return false
+		}
+		if matched {
+			slog.Debug("host is excluded", "hostID", host.ID, "hostName", host.Name)
+			return false
+		}
+	}
+	return true
+}
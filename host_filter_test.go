@@ -0,0 +1,143 @@
+package maprobe_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+var testHostMetadata = map[string]string{
+	"/api/v0/hosts/filter-web-1/metadata/deploy": `{"env":"production","version":3}`,
+	"/api/v0/hosts/filter-web-2/metadata/deploy": `{"env":"staging","version":2}`,
+}
+
+// testMackerelServer returns a mock server of Mackerel API which responds with api (path -> body).
+func testMackerelServer(t *testing.T, api map[string]string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := api[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"not found"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+var testFilterHosts = []*mackerel.Host{
+	{ID: "filter-web-1", Name: "web-1", CustomIdentifier: "i-0001", Interfaces: []mackerel.Interface{{Name: "eth0"}, {Name: "eth1"}}},
+	{ID: "filter-web-2", Name: "web-2", CustomIdentifier: "i-0002", Interfaces: []mackerel.Interface{{Name: "eth0"}}},
+	{ID: "filter-db-1", Name: "db-1", Interfaces: []mackerel.Interface{{Name: "eth0"}}},
+}
+
+func TestHostFilter(t *testing.T) {
+	ts := testMackerelServer(t, testHostMetadata)
+	client := maprobe.NewTestClient(ts.URL)
+	tests := []struct {
+		name   string
+		filter string
+		expect []string
+	}{
+		{
+			name:   "include name",
+			filter: "include: {name: '^web-'}",
+			expect: []string{"filter-web-1", "filter-web-2"},
+		},
+		{
+			name:   "exclude name",
+			filter: "exclude: {name: '^web-2$'}",
+			expect: []string{"filter-web-1", "filter-db-1"},
+		},
+		{
+			name:   "include custom_identifier",
+			filter: "include: {custom_identifier: '^i-'}",
+			expect: []string{"filter-web-1", "filter-web-2"},
+		},
+		{
+			name:   "include interface",
+			filter: "include: {interface: eth1}",
+			expect: []string{"filter-web-1"},
+		},
+		{
+			name:   "include metadata",
+			filter: "include: {metadata: {deploy.env: '^production$'}}",
+			expect: []string{"filter-web-1"},
+		},
+		{
+			name:   "exclude metadata",
+			filter: "exclude: {metadata: {deploy.version: '^2$'}}",
+			expect: []string{"filter-web-1", "filter-db-1"},
+		},
+		{
+			name:   "include and exclude",
+			filter: "include: {name: '^web-'}\n    exclude: {metadata: {deploy: 'staging'}}",
+			expect: []string{"filter-web-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := loadTestConfig(t, filterConfig(tt.filter))
+			var ids []string
+			for _, h := range c.Probes[0].FilterHosts(testFilterHosts, client) {
+				ids = append(ids, h.ID)
+			}
+			if !slices.Equal(ids, tt.expect) {
+				t.Errorf("unexpected hosts %v, want %v", ids, tt.expect)
+			}
+		})
+	}
+}
+
+func TestHostFilterMetadataError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	client := maprobe.NewTestClient(ts.URL)
+	hosts := []*mackerel.Host{{ID: "filter-error-1", Name: "error-1"}}
+	for _, filter := range []string{
+		"include: {metadata: {deploy.env: '^production$'}}",
+		"exclude: {metadata: {deploy.env: '^staging$'}}",
+	} {
+		c := loadTestConfig(t, filterConfig(filter))
+		if filtered := c.Probes[0].FilterHosts(hosts, client); len(filtered) != 0 {
+			t.Errorf("hosts must be skipped when the metadata cannot be fetched for %s", filter)
+		}
+	}
+}
+
+func TestHostFilterInvalid(t *testing.T) {
+	filters := []string{
+		"include: {}",
+		"exclude: {name: '['}",
+		"include: {metadata: {.env: production}}",
+	}
+	for _, filter := range filters {
+		f := writeTestConfig(t, filterConfig(filter))
+		if _, _, err := maprobe.LoadConfig(context.Background(), f); err == nil {
+			t.Errorf("must be failed %s", filter)
+		}
+	}
+}
+
+// filterConfig returns a config of a probe with the filter.
+func filterConfig(filter string) string {
+	return `
+probes:
+  - service: web
+    ` + filter + `
+    ping:
+      address: "{{ .Host.Name }}"
+`
+}
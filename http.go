@@ -7,17 +7,19 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptrace"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"fmt"
-
-	mackerel "github.com/mackerelio/mackerel-client-go"
 )
 
 var (
 	DefaultHTTPTimeout         = 15 * time.Second
+	DefaultHTTPMaxRedirects    = 10
 	DefaultHTTPMetricKeyPrefix = "http"
 )
 
@@ -30,16 +32,32 @@ type HTTPProbeConfig struct {
 	Timeout            time.Duration     `yaml:"timeout"`
 	NoCheckCertificate bool              `yaml:"no_check_certificate"`
 	MetricKeyPrefix    string            `yaml:"metric_key_prefix"`
+	ExpectStatus       string            `yaml:"expect_status"`
+	FollowRedirects    *bool             `yaml:"follow_redirects"`
+	MaxRedirects       int               `yaml:"max_redirects"`
+	ExpectFinalURL     string            `yaml:"expect_final_url"`
+	Extract            []*ExtractConfig  `yaml:"extract"`
+
+	TLSClientConfig `yaml:",inline"`
 }
 
-func (pc *HTTPProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
+func (pc *HTTPProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
 	p := &HTTPProbe{
 		hostID:             host.ID,
 		metricKeyPrefix:    pc.MetricKeyPrefix,
 		Timeout:            pc.Timeout,
 		NoCheckCertificate: pc.NoCheckCertificate,
+		FollowRedirects:    true,
+		MaxRedirects:       pc.MaxRedirects,
+	}
+	if pc.FollowRedirects != nil {
+		p.FollowRedirects = *pc.FollowRedirects
 	}
 	var err error
+	p.TLSClientConfig, err = pc.TLSClientConfig.expand(host)
+	if err != nil {
+		return nil, err
+	}
 	p.URL, err = expandPlaceHolder(pc.URL, host, nil)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
@@ -73,6 +91,27 @@ func (pc *HTTPProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 		}
 	}
 
+	p.ExpectStatus, err = parseStatusCodeRanges(pc.ExpectStatus)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_status: %w", err)
+	}
+
+	pattern, err = expandPlaceHolder(pc.ExpectFinalURL, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_final_url: %w", err)
+	}
+	if pattern != "" {
+		p.ExpectFinalURL, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect_final_url: %w", err)
+		}
+	}
+
+	p.Extractors, err = newExtractors(pc.Extract, host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extract: %w", err)
+	}
+
 	// default
 	if p.Method == "" {
 		p.Method = http.MethodGet
@@ -80,6 +119,9 @@ func (pc *HTTPProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 	if p.Timeout == 0 {
 		p.Timeout = DefaultHTTPTimeout
 	}
+	if p.MaxRedirects == 0 {
+		p.MaxRedirects = DefaultHTTPMaxRedirects
+	}
 	if p.metricKeyPrefix == "" {
 		p.metricKeyPrefix = DefaultHTTPMetricKeyPrefix
 	}
@@ -98,6 +140,12 @@ type HTTPProbe struct {
 	ExpectPattern      *regexp.Regexp
 	Timeout            time.Duration
 	NoCheckCertificate bool
+	ExpectStatus       statusCodeRanges
+	FollowRedirects    bool
+	MaxRedirects       int
+	ExpectFinalURL     *regexp.Regexp
+	Extractors         []*extractor
+	TLSClientConfig
 }
 
 func (p *HTTPProbe) HostID() string {
@@ -140,10 +188,34 @@ func (p *HTTPProbe) Run(ctx context.Context) (ms Metrics, err error) {
 	}
 	req.Header.Set("Connection", "close") // do not keep alive to health check.
 
+	trace := &httpTrace{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.ClientTrace()))
+	defer func() {
+		ms = append(ms, trace.Metrics(p)...)
+	}()
+
+	tlsConfig, err := p.TLSClientConfig.newTLSConfig(p.NoCheckCertificate)
+	if err != nil {
+		return ms, err
+	}
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: p.NoCheckCertificate},
+		TLSClientConfig: tlsConfig,
+	}
+	var redirects int
+	client := &http.Client{
+		Transport: tr,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !p.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > p.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", p.MaxRedirects)
+			}
+			redirects = len(via)
+			slog.Debug("http redirect", "url", req.URL, "redirects", redirects)
+			return nil
+		},
 	}
-	client := &http.Client{Transport: tr}
 
 	slog.Debug("http request", "method", req.Method, "url", req.URL)
 	resp, err := client.Do(req)
@@ -162,17 +234,50 @@ func (p *HTTPProbe) Run(ctx context.Context) (ms Metrics, err error) {
 	}
 
 	ms = append(ms, newMetric(p, "status.code", float64(resp.StatusCode)))
-	if resp.StatusCode >= 400 {
-		ok = false
+	ms = append(ms, newMetric(p, "redirect.count", float64(redirects)))
+
+	finalURL := resp.Request.URL.String()
+	var finalURLMismatch bool
+	if p.ExpectFinalURL != nil {
+		finalURLMismatch = !p.ExpectFinalURL.MatchString(finalURL)
+	} else {
+		finalURLMismatch = finalURL != req.URL.String()
+	}
+	if finalURLMismatch {
+		ms = append(ms, newMetric(p, "final_url.mismatch", 1))
+	} else {
+		ms = append(ms, newMetric(p, "final_url.mismatch", 0))
 	}
 
 	body, err := io.ReadAll(resp.Body)
+	trace.BodyDone()
 	if err != nil {
 		slog.Warn("HTTP read body failed", "error", err)
 		return ms, fmt.Errorf("read body failed: %w", err)
 	}
 	ms = append(ms, newMetric(p, "content.length", float64(len(body))))
 
+	src := newExtractSource(body)
+	for _, e := range p.Extractors {
+		v, err := e.ExtractFloat(src)
+		if err != nil {
+			slog.Warn("failed to extract value from HTTP response", "url", p.URL, "error", err)
+			continue
+		}
+		ms = append(ms, newMetric(p, e.Name, v))
+	}
+
+	if len(p.ExpectStatus) > 0 {
+		if !p.ExpectStatus.Contains(resp.StatusCode) {
+			return ms, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+	} else if resp.StatusCode >= 400 {
+		return ms, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if p.ExpectFinalURL != nil && finalURLMismatch {
+		return ms, fmt.Errorf("unexpected final URL %s", finalURL)
+	}
+
 	if p.ExpectPattern != nil {
 		if !p.ExpectPattern.Match(body) {
 			return ms, fmt.Errorf("unexpected response")
@@ -182,3 +287,120 @@ func (p *HTTPProbe) Run(ctx context.Context) (ms Metrics, err error) {
 	ok = true
 	return
 }
+
+type statusCodeRange struct {
+	Min int
+	Max int
+}
+
+// statusCodeRanges represents a set of HTTP status codes like "200-299,304".
+type statusCodeRanges []statusCodeRange
+
+func (rs statusCodeRanges) Contains(code int) bool {
+	for _, r := range rs {
+		if r.Min <= code && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+func parseStatusCodeRanges(s string) (statusCodeRanges, error) {
+	var rs statusCodeRanges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, found := strings.Cut(part, "-")
+		if !found {
+			to = from
+		}
+		min, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %s", part)
+		}
+		max, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %s", part)
+		}
+		if min > max {
+			return nil, fmt.Errorf("invalid status code range %s", part)
+		}
+		rs = append(rs, statusCodeRange{Min: min, Max: max})
+	}
+	return rs, nil
+}
+
+// httpTrace records the timings of each phase of a HTTP request.
+type httpTrace struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+	bodyDone                  time.Time
+}
+
+func (t *httpTrace) ClientTrace() *httptrace.ClientTrace {
+	now := func(ts *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if ts.IsZero() {
+			*ts = time.Now()
+		}
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart: func(_, _ string) {
+			now(&t.connectStart)
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				now(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { now(&t.tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				now(&t.tlsDone)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			now(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	}
+}
+
+func (t *httpTrace) BodyDone() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bodyDone = time.Now()
+}
+
+// Metrics returns the elapsed seconds of phases that have been completed.
+func (t *httpTrace) Metrics(p Probe) Metrics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ms Metrics
+	phases := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{"dns_lookup.seconds", t.dnsStart, t.dnsDone},
+		{"connect.seconds", t.connectStart, t.connectDone},
+		{"tls_handshake.seconds", t.tlsStart, t.tlsDone},
+		{"first_byte.seconds", t.wroteRequest, t.firstByte},
+		{"transfer.seconds", t.firstByte, t.bodyDone},
+	}
+	for _, phase := range phases {
+		if phase.start.IsZero() || phase.end.IsZero() {
+			continue
+		}
+		ms = append(ms, newMetric(p, phase.name, phase.end.Sub(phase.start).Seconds()))
+	}
+	return ms
+}
@@ -0,0 +1,355 @@
+package maprobe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultHTTPScenarioMetricKeyPrefix = "http_scenario"
+)
+
+var httpScenarioStepNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type HTTPScenarioProbeConfig struct {
+	Steps              []*HTTPScenarioStepConfig `yaml:"steps"`
+	NoCheckCertificate bool                      `yaml:"no_check_certificate"`
+	MetricKeyPrefix    string                    `yaml:"metric_key_prefix"`
+
+	TLSClientConfig `yaml:",inline"`
+}
+
+type HTTPScenarioStepConfig struct {
+	Name          string                       `yaml:"name"`
+	URL           string                       `yaml:"url"`
+	Method        string                       `yaml:"method"`
+	Headers       map[string]string            `yaml:"headers"`
+	Body          string                       `yaml:"body"`
+	ExpectPattern string                       `yaml:"expect_pattern"`
+	ExpectStatus  string                       `yaml:"expect_status"`
+	Timeout       time.Duration                `yaml:"timeout"`
+	Capture       []*HTTPScenarioCaptureConfig `yaml:"capture"`
+}
+
+// HTTPScenarioCaptureConfig defines a variable captured from a response.
+// One of jq, regexp, header or cookie is required.
+type HTTPScenarioCaptureConfig struct {
+	Name   string `yaml:"name"`
+	JQ     string `yaml:"jq"`
+	Regexp string `yaml:"regexp"`
+	Header string `yaml:"header"`
+	Cookie string `yaml:"cookie"`
+}
+
+func (pc *HTTPScenarioProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
+	p := &HTTPScenarioProbe{
+		host:               host,
+		metricKeyPrefix:    pc.MetricKeyPrefix,
+		NoCheckCertificate: pc.NoCheckCertificate,
+	}
+	if len(pc.Steps) == 0 {
+		return nil, fmt.Errorf("no steps")
+	}
+	var err error
+	p.TLSClientConfig, err = pc.TLSClientConfig.expand(host)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(pc.Steps))
+	for i, sc := range pc.Steps {
+		step, err := sc.generateStep(i, host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %d: %w", i+1, err)
+		}
+		if _, found := names[step.Name]; found {
+			return nil, fmt.Errorf("duplicated step name %s", step.Name)
+		}
+		names[step.Name] = struct{}{}
+		p.Steps = append(p.Steps, step)
+	}
+
+	if p.metricKeyPrefix == "" {
+		p.metricKeyPrefix = DefaultHTTPScenarioMetricKeyPrefix
+	}
+	return p, nil
+}
+
+func (sc *HTTPScenarioStepConfig) generateStep(i int, host *ProbeHost) (*httpScenarioStep, error) {
+	step := &httpScenarioStep{
+		Name:          sc.Name,
+		URL:           sc.URL,
+		Method:        sc.Method,
+		Headers:       sc.Headers,
+		Body:          sc.Body,
+		ExpectPattern: sc.ExpectPattern,
+		Timeout:       sc.Timeout,
+	}
+	if step.Name == "" {
+		step.Name = "step" + strconv.Itoa(i+1)
+	}
+	if !httpScenarioStepNameRegexp.MatchString(step.Name) {
+		return nil, fmt.Errorf("invalid name %s", step.Name)
+	}
+	if step.URL == "" {
+		return nil, fmt.Errorf("no url")
+	}
+
+	var err error
+	step.ExpectStatus, err = parseStatusCodeRanges(sc.ExpectStatus)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_status: %w", err)
+	}
+
+	for _, cc := range sc.Capture {
+		c := &httpScenarioCapture{
+			Name:   cc.Name,
+			Header: cc.Header,
+			Cookie: cc.Cookie,
+		}
+		if c.Name == "" {
+			return nil, fmt.Errorf("capture name is required")
+		}
+		if c.Header == "" && c.Cookie == "" {
+			c.extractor, err = (&ExtractConfig{Name: cc.Name, JQ: cc.JQ, Regexp: cc.Regexp}).newExtractor(host)
+			if err != nil {
+				return nil, fmt.Errorf("invalid capture: %w", err)
+			}
+		} else if c.Header != "" && c.Cookie != "" || cc.JQ != "" || cc.Regexp != "" {
+			return nil, fmt.Errorf("invalid capture %s: jq, regexp, header and cookie are exclusive", c.Name)
+		}
+		step.Captures = append(step.Captures, c)
+	}
+
+	if step.Method == "" {
+		step.Method = http.MethodGet
+	}
+	if step.Timeout == 0 {
+		step.Timeout = DefaultHTTPTimeout
+	}
+	return step, nil
+}
+
+type HTTPScenarioProbe struct {
+	host            *ProbeHost
+	metricKeyPrefix string
+
+	Steps              []*httpScenarioStep
+	NoCheckCertificate bool
+	TLSClientConfig
+}
+
+type httpScenarioStep struct {
+	Name string
+
+	// URL, Headers, Body and ExpectPattern are expanded at run time
+	// because these may refer to variables captured by previous steps.
+	URL           string
+	Method        string
+	Headers       map[string]string
+	Body          string
+	ExpectPattern string
+	ExpectStatus  statusCodeRanges
+	Timeout       time.Duration
+	Captures      []*httpScenarioCapture
+}
+
+type httpScenarioCapture struct {
+	Name   string
+	Header string
+	Cookie string
+
+	extractor *extractor
+}
+
+func (p *HTTPScenarioProbe) HostID() string {
+	return p.host.ID
+}
+
+func (p *HTTPScenarioProbe) MetricName(name string) string {
+	return p.metricKeyPrefix + "." + name
+}
+
+func (p *HTTPScenarioProbe) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+func (p *HTTPScenarioProbe) Run(ctx context.Context) (ms Metrics, err error) {
+	var ok bool
+	var completed int
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, "elapsed.seconds", elapsed.Seconds()))
+		ms = append(ms, newMetric(p, "steps.completed", float64(completed)))
+		if ok {
+			ms = append(ms, newMetric(p, "check.ok", 1))
+		} else {
+			ms = append(ms, newMetric(p, "check.ok", 0))
+		}
+		slog.Debug("http scenario probe completed", "metrics", ms.String())
+	}()
+
+	// cookies are shared among steps
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return ms, err
+	}
+	tlsConfig, err := p.TLSClientConfig.newTLSConfig(p.NoCheckCertificate)
+	if err != nil {
+		return ms, err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: true,
+		},
+		Jar: jar,
+	}
+
+	vars := make(map[string]string)
+	for _, step := range p.Steps {
+		stepMetrics, err := p.runStep(ctx, client, step, vars)
+		ms = append(ms, stepMetrics...)
+		if err != nil {
+			return ms, fmt.Errorf("step %s failed: %w", step.Name, err)
+		}
+		completed++
+	}
+
+	ok = true
+	return
+}
+
+func (p *HTTPScenarioProbe) runStep(ctx context.Context, client *http.Client, step *httpScenarioStep, vars map[string]string) (ms Metrics, err error) {
+	var ok bool
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, step.Name+".response_time.seconds", elapsed.Seconds()))
+		if ok {
+			ms = append(ms, newMetric(p, step.Name+".check.ok", 1))
+		} else {
+			ms = append(ms, newMetric(p, step.Name+".check.ok", 0))
+		}
+	}()
+
+	u, err := expandPlaceHolderWithVars(step.URL, p.host, vars)
+	if err != nil {
+		return ms, fmt.Errorf("invalid URL: %w", err)
+	}
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return ms, fmt.Errorf("invalid URL %s", u)
+	}
+	body, err := expandPlaceHolderWithVars(step.Body, p.host, vars)
+	if err != nil {
+		return ms, fmt.Errorf("invalid body: %w", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, step.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(timeoutCtx, step.Method, u, strings.NewReader(body))
+	if err != nil {
+		return ms, fmt.Errorf("invalid HTTP request: %w", err)
+	}
+	for name, value := range step.Headers {
+		v, err := expandPlaceHolderWithVars(value, p.host, vars)
+		if err != nil {
+			return ms, fmt.Errorf("invalid header %s: %w", name, err)
+		}
+		req.Header.Set(name, v)
+	}
+
+	slog.Debug("http scenario request", "step", step.Name, "method", req.Method, "url", req.URL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return ms, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	ms = append(ms, newMetric(p, step.Name+".status.code", float64(resp.StatusCode)))
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ms, fmt.Errorf("read body failed: %w", err)
+	}
+
+	if len(step.ExpectStatus) > 0 {
+		if !step.ExpectStatus.Contains(resp.StatusCode) {
+			return ms, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+	} else if resp.StatusCode >= 400 {
+		return ms, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if step.ExpectPattern != "" {
+		pattern, err := expandPlaceHolderWithVars(step.ExpectPattern, p.host, vars)
+		if err != nil {
+			return ms, fmt.Errorf("invalid expect_pattern: %w", err)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return ms, fmt.Errorf("invalid expect_pattern: %w", err)
+		}
+		if !re.Match(respBody) {
+			return ms, fmt.Errorf("unexpected response")
+		}
+	}
+
+	src := newExtractSource(respBody)
+	for _, c := range step.Captures {
+		v, err := c.capture(resp, client.Jar, src)
+		if err != nil {
+			return ms, fmt.Errorf("capture failed: %w", err)
+		}
+		slog.Debug("http scenario captured", "step", step.Name, "name", c.Name)
+		vars[c.Name] = v
+	}
+
+	ok = true
+	return
+}
+
+func (c *httpScenarioCapture) capture(resp *http.Response, jar http.CookieJar, src *extractSource) (string, error) {
+	switch {
+	case c.Header != "":
+		if v := resp.Header.Get(c.Header); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%s: header %s not found", c.Name, c.Header)
+	case c.Cookie != "":
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == c.Cookie {
+				return cookie.Value, nil
+			}
+		}
+		for _, cookie := range jar.Cookies(resp.Request.URL) {
+			if cookie.Name == c.Cookie {
+				return cookie.Value, nil
+			}
+		}
+		return "", fmt.Errorf("%s: cookie %s not found", c.Name, c.Cookie)
+	default:
+		v, err := c.extractor.Extract(src)
+		if err != nil {
+			return "", err
+		}
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case float64:
+			// avoid exponent form of large numbers like IDs
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,163 @@
+package maprobe_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+func testHTTPScenarioServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			User string `json:"user"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.User != "test" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "sess-" + req.User, Path: "/"})
+		w.Header().Set("X-Request-Id", "req-1")
+		fmt.Fprint(w, `{"message":"welcome"}`)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("session")
+		if err != nil || c.Value != "sess-test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token":"secret-token","expires_in":3600,"user_id":12345678}`)
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if id := r.URL.Query().Get("user_id"); id != "12345678" {
+			http.Error(w, "unexpected user_id "+id, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "hello %s", r.URL.Query().Get("request_id"))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestHTTPScenario(t *testing.T) {
+	ts := testHTTPScenarioServer()
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		body        string
+		expectError bool
+		checks      map[string]float64
+	}{
+		{
+			name: "success",
+			body: `{"user":"{{ .Host.Name }}"}`,
+			checks: map[string]float64{
+				"http_scenario.login.check.ok":  1,
+				"http_scenario.token.check.ok":  1,
+				"http_scenario.step3.check.ok":  1,
+				"http_scenario.check.ok":        1,
+				"http_scenario.steps.completed": 3,
+			},
+		},
+		{
+			name:        "login failed",
+			body:        `{"user":"nobody"}`,
+			expectError: true,
+			checks: map[string]float64{
+				"http_scenario.login.check.ok":    0,
+				"http_scenario.login.status.code": 403,
+				"http_scenario.check.ok":          0,
+				"http_scenario.steps.completed":   0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := &maprobe.HTTPScenarioProbeConfig{
+				Steps: []*maprobe.HTTPScenarioStepConfig{
+					{
+						Name:         "login",
+						URL:          ts.URL + "/login",
+						Method:       http.MethodPost,
+						Body:         tt.body,
+						ExpectStatus: "200",
+						Capture: []*maprobe.HTTPScenarioCaptureConfig{
+							{Name: "session", Cookie: "session"},
+							{Name: "request_id", Header: "X-Request-Id"},
+						},
+					},
+					{
+						Name:          "token",
+						URL:           ts.URL + "/token",
+						ExpectPattern: `"token"`,
+						Capture: []*maprobe.HTTPScenarioCaptureConfig{
+							{Name: "token", JQ: ".token"},
+							{Name: "user_id", JQ: ".user_id"},
+						},
+					},
+					{
+						URL: ts.URL + "/api?request_id={{ .Vars.request_id }}&user_id={{ .Vars.user_id }}",
+						Headers: map[string]string{
+							"Authorization": "Bearer {{ .Vars.token }}",
+						},
+						ExpectPattern: "^hello {{ .Vars.request_id }}$",
+					},
+				},
+			}
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			found := map[string]bool{}
+			for _, m := range ms {
+				if v, ok := tt.checks[m.Name]; ok {
+					found[m.Name] = true
+					if m.Value != v {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, v)
+					}
+				}
+			}
+			for name := range tt.checks {
+				if !found[name] {
+					t.Errorf("metric %s not found", name)
+				}
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestHTTPScenarioInvalid(t *testing.T) {
+	configs := []*maprobe.HTTPScenarioProbeConfig{
+		{},
+		{Steps: []*maprobe.HTTPScenarioStepConfig{{Name: "a"}}},
+		{Steps: []*maprobe.HTTPScenarioStepConfig{{Name: "a b", URL: "http://example.com"}}},
+		{Steps: []*maprobe.HTTPScenarioStepConfig{{Name: "a", URL: "http://example.com"}, {Name: "a", URL: "http://example.com"}}},
+		{Steps: []*maprobe.HTTPScenarioStepConfig{{URL: "http://example.com", ExpectStatus: "abc"}}},
+		{Steps: []*maprobe.HTTPScenarioStepConfig{{URL: "http://example.com", Capture: []*maprobe.HTTPScenarioCaptureConfig{{Name: "x"}}}}},
+		{Steps: []*maprobe.HTTPScenarioStepConfig{{URL: "http://example.com", Capture: []*maprobe.HTTPScenarioCaptureConfig{{Name: "x", Header: "X", JQ: ".x"}}}}},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}
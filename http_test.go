@@ -12,10 +12,12 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/fujiwara/maprobe"
+	"github.com/google/go-cmp/cmp"
 	mackerel "github.com/mackerelio/mackerel-client-go"
 )
 
@@ -92,7 +94,7 @@ func TestHTTP(t *testing.T) {
 		ExpectPattern: "^Hello",
 	}
 
-	probe, err := pc.GenerateProbe(&mackerel.Host{ID: "test"})
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -103,8 +105,10 @@ func TestHTTP(t *testing.T) {
 		t.Error(err)
 	}
 
-	if len(ms) != 4 {
-		t.Error("unexpected metrics num")
+	// check.ok, response_time, status.code, content.length, redirect.count, final_url.mismatch,
+	// connect, first_byte, transfer
+	if len(ms) != 9 {
+		t.Errorf("unexpected metrics num: got %d, want 9", len(ms))
 	}
 	for _, m := range ms {
 		switch m.Name {
@@ -124,6 +128,10 @@ func TestHTTP(t *testing.T) {
 			if m.Value != 15 {
 				t.Errorf("unexpected content length %f", m.Value)
 			}
+		case "http.first_byte.seconds":
+			if m.Value < 0.1 {
+				t.Error("first byte time too short")
+			}
 		}
 	}
 	t.Log(ms.String())
@@ -136,7 +144,7 @@ func TestHTTPS(t *testing.T) {
 		NoCheckCertificate: true, // Accept self-signed certificate
 	}
 
-	probe, err := pc.GenerateProbe(&mackerel.Host{ID: "test"})
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -147,12 +155,13 @@ func TestHTTPS(t *testing.T) {
 		t.Error(err)
 	}
 
-	// Should have 5 metrics: check.ok, response_time, status.code, content.length, certificate.expires_in_days
-	if len(ms) != 5 {
-		t.Errorf("unexpected metrics num: got %d, want 5", len(ms))
+	// Should have 11 metrics: check.ok, response_time, status.code, content.length, certificate.expires_in_days,
+	// redirect.count, final_url.mismatch, connect, tls_handshake, first_byte, transfer
+	if len(ms) != 11 {
+		t.Errorf("unexpected metrics num: got %d, want 11", len(ms))
 	}
 
-	var foundCertMetric bool
+	var foundCertMetric, foundTLSHandshakeMetric bool
 	for _, m := range ms {
 		switch m.Name {
 		case "http.response_time.seconds":
@@ -171,6 +180,11 @@ func TestHTTPS(t *testing.T) {
 			if m.Value != 16 { // "Hello HTTPS Test"
 				t.Errorf("unexpected content length %f", m.Value)
 			}
+		case "http.tls_handshake.seconds":
+			foundTLSHandshakeMetric = true
+			if m.Value <= 0 {
+				t.Errorf("unexpected tls handshake time: %f", m.Value)
+			}
 		case "http.certificate.expires_in_days":
 			foundCertMetric = true
 			// Should be around 30 days (certificate expires in 30 days)
@@ -183,5 +197,254 @@ func TestHTTPS(t *testing.T) {
 	if !foundCertMetric {
 		t.Error("certificate.expires_in_days metric not found")
 	}
+	if !foundTLSHandshakeMetric {
+		t.Error("tls_handshake.seconds metric not found")
+	}
+	t.Log(ms.String())
+}
+
+func TestHTTPTimingPhases(t *testing.T) {
+	u, _ := url.Parse(HTTPServerURL)
+	pc := &maprobe.HTTPProbeConfig{
+		URL:             "http://localhost:" + u.Port() + "/",
+		MetricKeyPrefix: "custom.http",
+	}
+
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := probe.Run(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+
+	phases := map[string]bool{
+		"custom.http.dns_lookup.seconds": false,
+		"custom.http.connect.seconds":    false,
+		"custom.http.first_byte.seconds": false,
+		"custom.http.transfer.seconds":   false,
+	}
+	for _, m := range ms {
+		if _, ok := phases[m.Name]; ok {
+			phases[m.Name] = true
+			if m.Value < 0 {
+				t.Errorf("unexpected %s: %f", m.Name, m.Value)
+			}
+		}
+		if m.Name == "custom.http.tls_handshake.seconds" {
+			t.Error("tls_handshake.seconds must not be reported for plain HTTP")
+		}
+	}
+	for name, found := range phases {
+		if !found {
+			t.Errorf("%s metric not found", name)
+		}
+	}
+	t.Log(ms.String())
+}
+
+func testHTTPRedirectServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "OK")
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/error", http.StatusFound)
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Error page")
+	})
+	mux.HandleFunc("/not_modified", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	mux.HandleFunc("/not_found", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestHTTPStatusAndRedirect(t *testing.T) {
+	ts := testHTTPRedirectServer()
+	defer ts.Close()
+	noFollow := false
+
+	tests := []struct {
+		name          string
+		config        *maprobe.HTTPProbeConfig
+		expectError   bool
+		redirects     float64
+		finalMismatch float64
+		status        float64
+	}{
+		{
+			name:   "ok",
+			config: &maprobe.HTTPProbeConfig{URL: ts.URL + "/ok", ExpectStatus: "200"},
+			status: 200,
+		},
+		{
+			name:        "not found",
+			config:      &maprobe.HTTPProbeConfig{URL: ts.URL + "/not_found"},
+			expectError: true,
+			status:      404,
+		},
+		{
+			name:   "not found expected",
+			config: &maprobe.HTTPProbeConfig{URL: ts.URL + "/not_found", ExpectStatus: "200-299, 404"},
+			status: 404,
+		},
+		{
+			name:        "not modified unexpected",
+			config:      &maprobe.HTTPProbeConfig{URL: ts.URL + "/not_modified", ExpectStatus: "200-299"},
+			expectError: true,
+			status:      304,
+		},
+		{
+			name:   "not modified expected",
+			config: &maprobe.HTTPProbeConfig{URL: ts.URL + "/not_modified", ExpectStatus: "200-299,304"},
+			status: 304,
+		},
+		{
+			name:          "follow redirects",
+			config:        &maprobe.HTTPProbeConfig{URL: ts.URL + "/login"},
+			redirects:     1,
+			finalMismatch: 1,
+			status:        200,
+		},
+		{
+			name:          "unexpected final URL",
+			config:        &maprobe.HTTPProbeConfig{URL: ts.URL + "/login", ExpectFinalURL: "/login$"},
+			expectError:   true,
+			redirects:     1,
+			finalMismatch: 1,
+			status:        200,
+		},
+		{
+			name:        "no follow redirects",
+			config:      &maprobe.HTTPProbeConfig{URL: ts.URL + "/login", FollowRedirects: &noFollow, ExpectStatus: "200"},
+			expectError: true,
+			status:      302,
+		},
+		{
+			name:        "too many redirects",
+			config:      &maprobe.HTTPProbeConfig{URL: ts.URL + "/loop", MaxRedirects: 3},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe, err := tt.config.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			for _, m := range ms {
+				switch m.Name {
+				case "http.check.ok":
+					if tt.expectError && m.Value != 0 || !tt.expectError && m.Value != 1 {
+						t.Errorf("unexpected check.ok %f", m.Value)
+					}
+				case "http.status.code":
+					if m.Value != tt.status {
+						t.Errorf("unexpected status.code %f", m.Value)
+					}
+				case "http.redirect.count":
+					if m.Value != tt.redirects {
+						t.Errorf("unexpected redirect.count %f", m.Value)
+					}
+				case "http.final_url.mismatch":
+					if m.Value != tt.finalMismatch {
+						t.Errorf("unexpected final_url.mismatch %f", m.Value)
+					}
+				}
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestHTTPInvalidExpectStatus(t *testing.T) {
+	for _, s := range []string{"abc", "200-", "299-200"} {
+		pc := &maprobe.HTTPProbeConfig{URL: "http://example.com", ExpectStatus: s}
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed for expect_status %q", s)
+		}
+	}
+}
+
+func TestHTTPExtract(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"queue":{"depth":42,"name":"jobs"},"workers":[{"busy":true},{"busy":false},{"busy":true}],"version":"build=1234"}`)
+	}))
+	defer ts.Close()
+
+	pc := &maprobe.HTTPProbeConfig{
+		URL:             ts.URL,
+		MetricKeyPrefix: "custom.status",
+		Extract: []*maprobe.ExtractConfig{
+			{Name: "queue.depth", JQ: ".queue.depth"},
+			{Name: "workers.busy", JQ: "[.workers[] | select(.busy)] | length"},
+			{Name: "workers.first_busy", JQ: ".workers[0].busy"},
+			{Name: "build", Regexp: `build=(\d+)`},
+			{Name: "queue.name", JQ: ".queue.name"},  // not a number
+			{Name: "missing", JQ: ".not_exists"},     // no value
+			{Name: "unmatched", Regexp: `foo=(\d+)`}, // not matched
+		},
+	}
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := probe.Run(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := map[string]float64{
+		"custom.status.queue.depth":        42,
+		"custom.status.workers.busy":       2,
+		"custom.status.workers.first_busy": 1,
+		"custom.status.build":              1234,
+	}
+	found := map[string]float64{}
+	for _, m := range ms {
+		switch m.Name {
+		case "custom.status.queue.name", "custom.status.missing", "custom.status.unmatched":
+			t.Errorf("unexpected metric %s", m.Name)
+		}
+		if _, ok := expected[m.Name]; ok {
+			found[m.Name] = m.Value
+		}
+	}
+	if diff := cmp.Diff(expected, found); diff != "" {
+		t.Errorf("unexpected extracted metrics (-want +got):\n%s", diff)
+	}
 	t.Log(ms.String())
 }
+
+func TestHTTPExtractInvalid(t *testing.T) {
+	extracts := [][]*maprobe.ExtractConfig{
+		{{JQ: ".foo"}},
+		{{Name: "foo"}},
+		{{Name: "foo", JQ: ".foo", Regexp: "foo"}},
+		{{Name: "foo", JQ: ".foo["}},
+		{{Name: "foo", Regexp: "("}},
+	}
+	for _, ex := range extracts {
+		pc := &maprobe.HTTPProbeConfig{URL: "http://example.com", Extract: ex}
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed for extract %#v", ex[0])
+		}
+	}
+}
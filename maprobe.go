@@ -61,6 +61,9 @@ func Run(ctx context.Context, wg *sync.WaitGroup, configPath string, once bool)
 	defer slog.Info("stopping maprobe")
 
 	slog.Info("starting maprobe")
+	if currentShard.Enabled() {
+		slog.Info("handling a shard of targets", "shard", currentShard.String())
+	}
 	conf, confDigest, err := LoadConfig(ctx, configPath)
 	if err != nil {
 		return err
@@ -101,9 +104,10 @@ func Run(ctx context.Context, wg *sync.WaitGroup, configPath string, once bool)
 	if len(conf.Probes) > 0 {
 		if conf.PostProbedMetrics {
 			if conf.Destination.Mackerel.Enabled {
-				wg.Add(2)
+				wg.Add(3)
 				go postHostMetricWorker(ctx, wg, client, chs)
 				go postServiceMetricWorker(ctx, wg, client, chs)
+				go postCheckReportWorker(ctx, wg, client, chs)
 			}
 			if conf.Destination.Otel.Enabled {
 				wg.Add(1)
@@ -111,9 +115,10 @@ func Run(ctx context.Context, wg *sync.WaitGroup, configPath string, once bool)
 			}
 		} else {
 			if conf.Destination.Mackerel.Enabled {
-				wg.Add(2)
+				wg.Add(3)
 				go dumpHostMetricWorker(ctx, wg, chs)
 				go dumpServiceMetricWorker(ctx, wg, chs)
+				go dumpCheckReportWorker(ctx, wg, chs)
 			}
 			if conf.Destination.Otel.Enabled {
 				wg.Add(1)
@@ -136,29 +141,42 @@ func Run(ctx context.Context, wg *sync.WaitGroup, configPath string, once bool)
 		}
 	}
 
-	ticker := time.NewTicker(ProbeInterval)
-	for {
-		var wg2 sync.WaitGroup
-		for _, pd := range conf.Probes {
-			wg2.Add(1)
-			go pd.RunProbes(ctx, client, chs, statsCollector, &wg2)
-		}
-		for _, ag := range conf.Aggregates {
-			wg2.Add(1)
-			go runAggregates(ctx, ag, client, chs, &wg2)
+	var running sync.WaitGroup
+	defer running.Wait() // wait for running jobs before closing channels
+
+	now := time.Now()
+	jobs := newJobs(conf, client, chs, statsCollector, now, nil)
+	if once {
+		for _, j := range jobs {
+			j.startOnce(ctx, &running, now)
 		}
-		wg2.Wait()
-		if once {
-			return nil
+		return nil
+	}
+
+	reloadAt := now.Add(ProbeInterval)
+	for {
+		now := time.Now()
+		for _, j := range jobs {
+			j.start(ctx, &running, now)
 		}
 
-		slog.Debug("waiting for a next tick")
+		next := nextRun(jobs, reloadAt)
+		slog.Debug("waiting for a next run", "next", next)
+		timer := time.NewTimer(time.Until(next))
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return nil
-		case <-ticker.C:
+		case <-timer.C:
 		}
 
+		if now := time.Now(); now.Before(reloadAt) {
+			continue
+		} else {
+			for !reloadAt.After(now) {
+				reloadAt = reloadAt.Add(ProbeInterval)
+			}
+		}
 		slog.Debug("checking a new config")
 		newConf, digest, err := LoadConfig(ctx, configPath)
 		if err != nil {
@@ -167,6 +185,7 @@ func Run(ctx context.Context, wg *sync.WaitGroup, configPath string, once bool)
 		} else if confDigest != digest {
 			conf = newConf
 			confDigest = digest
+			jobs = newJobs(conf, client, chs, statsCollector, time.Now(), jobs)
 			slog.Info("config reloaded")
 			slog.Debug("reloaded config", "config", conf)
 		}
@@ -432,6 +451,44 @@ func newOtelExporter(ctx context.Context, oc *OtelConfig) (*otlpmetricgrpc.Expor
 	return exporter, resource, nil
 }
 
+func postCheckReportWorker(ctx context.Context, wg *sync.WaitGroup, client *Client, chs *Channels) {
+	slog.Info("starting postCheckReportWorker")
+	defer wg.Done()
+	ticker := time.NewTicker(10 * time.Second)
+	reports := make([]*mackerel.CheckReport, 0, PostMetricBufferLength)
+	run := true
+	for run {
+		select {
+		case r, cont := <-chs.CheckReports:
+			if cont {
+				reports = append(reports, r)
+				if len(reports) < PostMetricBufferLength {
+					continue
+				}
+			} else {
+				slog.Info("shutting down postCheckReportWorker")
+				run = false
+			}
+		case <-ticker.C:
+		}
+		if len(reports) == 0 {
+			continue
+		}
+		slog.Debug("posting check reports to Mackerel", "count", len(reports))
+		b, _ := json.Marshal(reports)
+		slog.Debug("check reports payload", "payload", string(b))
+		if err := doRetry(ctx, func() error {
+			return client.PostCheckReports(ctx, reports)
+		}); err != nil {
+			slog.Error("failed to post check reports to Mackerel", "error", err)
+			continue
+		}
+		slog.Debug("post check reports succeeded")
+		// success. reset buffer
+		reports = reports[:0]
+	}
+}
+
 func dumpHostMetricWorker(_ context.Context, wg *sync.WaitGroup, chs *Channels) {
 	defer wg.Done()
 	slog.Info("starting dumpHostMetricWorker")
@@ -450,6 +507,15 @@ func dumpServiceMetricWorker(_ context.Context, wg *sync.WaitGroup, chs *Channel
 	}
 }
 
+func dumpCheckReportWorker(_ context.Context, wg *sync.WaitGroup, chs *Channels) {
+	defer wg.Done()
+	slog.Info("starting dumpCheckReportWorker")
+	for r := range chs.CheckReports {
+		b, _ := json.Marshal(r)
+		slog.Info("check report", "report", string(b))
+	}
+}
+
 func dumpOtelMetricWorker(_ context.Context, wg *sync.WaitGroup, chs *Channels) {
 	defer wg.Done()
 	slog.Info("starting dumpOtelMetricWorker")
@@ -459,7 +525,12 @@ func dumpOtelMetricWorker(_ context.Context, wg *sync.WaitGroup, chs *Channels)
 }
 
 type templateParam struct {
-	Host *mackerel.Host
+	Host            *mackerel.Host
+	Target          *Target
+	Metadata        map[string]any
+	ServiceMetadata map[string]any
+	RoleMetadata    map[string]any
+	Vars            map[string]string
 }
 
 func doRetry(ctx context.Context, f func() error) error {
@@ -493,6 +564,8 @@ func Main(ctx context.Context, args []string) error {
 		return fmt.Errorf("failed to parse arguments: %w", err)
 	}
 
+	SecretsFile = cli.SecretsFile
+
 	fullCommandName := kongCtx.Command()
 	// Extract the base command name (Kong may return "command <arg>" format)
 	cmdName, _, _ := strings.Cut(fullCommandName, " ")
@@ -508,20 +581,34 @@ func Main(ctx context.Context, args []string) error {
 			wg.Add(1)
 			go RunFirehoseEndpoint(ctx, &wg, cli.Agent.Port)
 		}
+		if currentShard, err = cli.Agent.Shard(); err != nil {
+			return err
+		}
 		wg.Add(1)
 		err = Run(ctx, &wg, cli.Agent.Config, false)
 	case "once":
+		if currentShard, err = cli.Once.Shard(); err != nil {
+			return err
+		}
 		wg.Add(1)
 		err = Run(ctx, &wg, cli.Once.Config, true)
 	case "lambda":
 		slog.Info("running on AWS Lambda", "config", cli.Lambda.Config)
+		if currentShard, err = cli.Lambda.Shard(); err != nil {
+			return err
+		}
 		wg.Add(1)
 		err = Run(ctx, &wg, cli.Lambda.Config, true)
 	case "ping":
+		privileged := !cli.Ping.Unprivileged
 		err = runProbe(ctx, cli.Ping.HostID, &PingProbeConfig{
-			Address: cli.Ping.Address,
-			Count:   cli.Ping.Count,
-			Timeout: cli.Ping.Timeout,
+			Address:    cli.Ping.Address,
+			Count:      cli.Ping.Count,
+			Timeout:    cli.Ping.Timeout,
+			IPVersion:  cli.Ping.IPVersion,
+			Size:       cli.Ping.Size,
+			Interval:   cli.Ping.Interval,
+			Privileged: &privileged,
 		})
 	case "tcp":
 		err = runProbe(ctx, cli.TCP.HostID, &TCPProbeConfig{
@@ -533,8 +620,22 @@ func Main(ctx context.Context, args []string) error {
 			ExpectPattern:      cli.TCP.ExpectPattern,
 			NoCheckCertificate: cli.TCP.NoCheckCertificate,
 			TLS:                cli.TCP.TLS,
+			TLSClientConfig:    cli.TCP.TLSClientConfig(),
+		})
+	case "udp":
+		err = runProbe(ctx, cli.UDP.HostID, &UDPProbeConfig{
+			Host:            cli.UDP.Host,
+			Port:            cli.UDP.Port,
+			Timeout:         cli.UDP.Timeout,
+			Send:            cli.UDP.Send,
+			SendHex:         cli.UDP.SendHex,
+			ExpectPattern:   cli.UDP.ExpectPattern,
+			ExpectPrefixHex: cli.UDP.ExpectPrefixHex,
+			NoResponse:      cli.UDP.NoResponse,
+			Retries:         cli.UDP.Retries,
 		})
 	case "http":
+		followRedirects := !cli.HTTP.NoFollowRedirects
 		err = runProbe(ctx, cli.HTTP.HostID, &HTTPProbeConfig{
 			URL:                cli.HTTP.URL,
 			Method:             cli.HTTP.Method,
@@ -543,6 +644,11 @@ func Main(ctx context.Context, args []string) error {
 			Timeout:            cli.HTTP.Timeout,
 			ExpectPattern:      cli.HTTP.ExpectPattern,
 			NoCheckCertificate: cli.HTTP.NoCheckCertificate,
+			ExpectStatus:       cli.HTTP.ExpectStatus,
+			FollowRedirects:    &followRedirects,
+			MaxRedirects:       cli.HTTP.MaxRedirects,
+			ExpectFinalURL:     cli.HTTP.ExpectFinalURL,
+			TLSClientConfig:    cli.HTTP.TLSClientConfig(),
 		})
 	case "grpc":
 		err = runProbe(ctx, cli.GRPC.HostID, &GRPCProbeConfig{
@@ -552,6 +658,22 @@ func Main(ctx context.Context, args []string) error {
 			TLS:                cli.GRPC.TLS,
 			NoCheckCertificate: cli.GRPC.NoCheckCertificate,
 			Metadata:           cli.GRPC.Metadata,
+			Method:             cli.GRPC.Method,
+			Request:            cli.GRPC.Request,
+			DescriptorSet:      cli.GRPC.DescriptorSet,
+			ExpectPattern:      cli.GRPC.ExpectPattern,
+			TLSClientConfig:    cli.GRPC.TLSClientConfig(),
+		})
+	case "dns":
+		err = runProbe(ctx, cli.DNS.HostID, &DNSProbeConfig{
+			Server:        cli.DNS.Server,
+			Port:          cli.DNS.Port,
+			Name:          cli.DNS.Name,
+			Type:          cli.DNS.Type,
+			TCP:           cli.DNS.TCP,
+			NoRecursion:   cli.DNS.NoRecursion,
+			ExpectPattern: cli.DNS.ExpectPattern,
+			Timeout:       cli.DNS.Timeout,
 		})
 	case "firehose-endpoint":
 		wg.Add(1)
@@ -581,7 +703,7 @@ func runProbe(ctx context.Context, id string, pc ProbeConfig) error {
 		return err
 	}
 	slog.Debug("host", "host", marshalJSON(host))
-	p, err := pc.GenerateProbe(host)
+	p, err := pc.GenerateProbe(&ProbeHost{Host: host})
 	if err != nil {
 		return err
 	}
@@ -638,7 +760,7 @@ func SetupLogger(logLevel, logFormat string) {
 		}
 		handler = sloghandler.NewLogHandler(w, opts)
 	}
-	logger := slog.New(handler)
+	logger := slog.New(&redactHandler{Handler: handler})
 	slog.SetDefault(logger)
 }
 
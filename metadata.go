@@ -0,0 +1,87 @@
+package maprobe
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+// MetadataConfig represents namespaces of Mackerel metadata available in templates.
+type MetadataConfig struct {
+	Host    []string `yaml:"host"`    // {{ .Metadata.<namespace> }}
+	Service []string `yaml:"service"` // {{ .ServiceMetadata.<namespace> }}
+	Role    []string `yaml:"role"`    // {{ .RoleMetadata.<namespace> }}
+}
+
+func (pd *ProbeDefinition) validateMetadata() error {
+	mc := pd.Metadata
+	if mc == nil {
+		return nil
+	}
+	if len(mc.Host) > 0 && (pd.IsServiceMetric || pd.Targets != nil) {
+		return fmt.Errorf("host metadata is available only for Mackerel hosts")
+	}
+	if len(mc.Service) > 0 && pd.Service.String() == "" {
+		return fmt.Errorf("service metadata requires service")
+	}
+	if len(mc.Role) > 0 && len(pd.Roles) == 0 {
+		return fmt.Errorf("role metadata requires role or roles")
+	}
+	return nil
+}
+
+// withMetadata returns a copy of the host with the metadata available in templates.
+func (pd *ProbeDefinition) withMetadata(host *ProbeHost, client *Client) *ProbeHost {
+	mc := pd.Metadata
+	if mc == nil {
+		return host
+	}
+	// the host may be shared with other definitions, so the metadata is set to a copy
+	v := *host
+	service := pd.Service.String()
+	attrs := []any{"hostID", host.ID, "hostName", host.Name}
+	if len(mc.Host) > 0 {
+		v.Metadata = fetchMetadata(mc.Host, func(ns string) (any, error) {
+			return client.GetHostMetadata(host.ID, ns)
+		}, attrs)
+	}
+	if len(mc.Service) > 0 {
+		v.ServiceMetadata = fetchMetadata(mc.Service, func(ns string) (any, error) {
+			return client.GetServiceMetadata(service, ns)
+		}, attrs)
+	}
+	if role := pd.roleOf(host.Host); len(mc.Role) > 0 && role != "" {
+		v.RoleMetadata = fetchMetadata(mc.Role, func(ns string) (any, error) {
+			return client.GetRoleMetadata(service, role, ns)
+		}, attrs)
+	}
+	return &v
+}
+
+// roleOf returns the first role of the definition which the host has.
+func (pd *ProbeDefinition) roleOf(host *mackerel.Host) string {
+	hostRoles := host.Roles[pd.Service.String()]
+	for _, r := range pd.Roles {
+		if slices.Contains(hostRoles, r.String()) {
+			return r.String()
+		}
+	}
+	return ""
+}
+
+func fetchMetadata(namespaces []string, get func(namespace string) (any, error), attrs []any) map[string]any {
+	m := make(map[string]any, len(namespaces))
+	for _, ns := range namespaces {
+		v, err := get(ns)
+		if err != nil {
+			slog.Warn("cannot get metadata", append([]any{"namespace", ns, "error", err}, attrs...)...)
+			continue
+		}
+		if v != nil {
+			m[ns] = v
+		}
+	}
+	return m
+}
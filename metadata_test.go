@@ -0,0 +1,105 @@
+package maprobe_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/maprobe"
+)
+
+var testMetadataAPI = map[string]string{
+	"/api/v0/hosts": `{"hosts":[
+		{"id":"metadata-web-1","name":"web-1","status":"working","roles":{"metadata":["app"]}},
+		{"id":"metadata-web-2","name":"web-2","status":"working","roles":{"metadata":["app"]}}
+	]}`,
+	"/api/v0/hosts/metadata-web-1/metadata/health":        `{"path":"/healthz","port":8080}`,
+	"/api/v0/hosts/metadata-web-2/metadata/health":        `{"path":"/ping","port":8081}`,
+	"/api/v0/services/metadata/metadata/config":           `{"env":"production"}`,
+	"/api/v0/services/metadata/roles/app/metadata/config": `{"tier":"frontend"}`,
+}
+
+func TestMetadataTemplate(t *testing.T) {
+	ts := testMackerelServer(t, testMetadataAPI)
+	client := maprobe.NewTestClient(ts.URL)
+	c := loadTestConfig(t, `
+probes:
+  - service: metadata
+    role: app
+    metadata:
+      host: [health, notfound]
+      service: [config]
+      role: [config]
+    command:
+      command: >-
+        printf '{{ .ServiceMetadata.config.env }}.{{ .RoleMetadata.config.tier }}.port_{{ .Metadata.health.port }}\t1\t%s\n' $(date +%s)
+`)
+	ms, _ := c.Probes[0].RunHostProbes(context.Background(), client, nil)
+	checks := map[string]string{
+		"metadata-web-1": "production.frontend.port_8080",
+		"metadata-web-2": "production.frontend.port_8081",
+	}
+	found := map[string]bool{}
+	for _, m := range ms {
+		if checks[m.HostID] == m.Name {
+			found[m.HostID] = true
+		} else {
+			t.Errorf("unexpected metric %s of %s", m.Name, m.HostID)
+		}
+	}
+	if len(found) != len(checks) {
+		t.Errorf("metrics not found %v", ms)
+	}
+}
+
+func TestMetadataInvalid(t *testing.T) {
+	filters := []string{
+		"metadata: {role: [config]}",
+		"service_metric: true\n    metadata: {host: [health]}",
+		"targets: {hosts: [{id: target-1}]}\n    metadata: {host: [health]}",
+	}
+	for _, filter := range filters {
+		f := writeTestConfig(t, filterConfig(filter))
+		if _, _, err := maprobe.LoadConfig(context.Background(), f); err == nil {
+			t.Errorf("must be failed %s", filter)
+		}
+	}
+}
+
+func TestMetadataFetchedEveryRun(t *testing.T) {
+	var port atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := port.Load()
+		if p == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		fmt.Fprintf(w, `{"port":%d}`, p)
+	}))
+	defer ts.Close()
+	client := maprobe.NewTestClient(ts.URL)
+
+	for _, tt := range []struct {
+		port   int64 // 0: the API fails
+		expect float64
+	}{
+		{port: 8080, expect: 8080},
+		{port: 8081, expect: 8081}, // edited metadata is used at the next run
+		{port: 0, expect: 8081},    // the previous result is used when the API fails
+	} {
+		port.Store(tt.port)
+		v, err := client.GetHostMetadata("metadata-fetch-1", "health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := v.(map[string]any)["port"]; p != tt.expect {
+			t.Errorf("unexpected port %v, want %v", p, tt.expect)
+		}
+	}
+}
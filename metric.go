@@ -1,8 +1,10 @@
 package maprobe
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -19,6 +21,9 @@ type Metric struct {
 	Value     float64
 	Timestamp time.Time
 	Attribute *Attribute
+
+	// OtelOnly metrics are not posted to Mackerel (e.g. per-hop metrics distinguished by attributes).
+	OtelOnly bool
 }
 
 func (m Metric) Otel() otelmetricdata.Metrics {
@@ -139,7 +144,7 @@ type Attribute struct {
 	Extra   map[string]string
 }
 
-func (a *Attribute) SetExtra(ex map[string]string, host *mackerel.Host) {
+func (a *Attribute) SetExtra(ex map[string]string, host *ProbeHost) {
 	if len(ex) == 0 {
 		return
 	}
@@ -226,3 +231,132 @@ func parseMetricLine(b string) (Metric, error) {
 	m.Attribute = attr
 	return m, nil
 }
+
+type jsonMetricLine struct {
+	Name       string            `json:"name"`
+	Value      *float64          `json:"value"`
+	Time       *float64          `json:"time"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// parseJSONMetricLine parses a JSON line like below. time (epoch seconds) and attributes are optional.
+// {"name":"foo.bar","value":42,"time":1755681797,"attributes":{"key1":"value1"}}
+func parseJSONMetricLine(b string) (Metric, error) {
+	var l jsonMetricLine
+	if err := json.Unmarshal([]byte(b), &l); err != nil {
+		return Metric{}, fmt.Errorf("invalid metric format: %w", err)
+	}
+	if l.Name == "" {
+		return Metric{}, fmt.Errorf("invalid metric format. name is empty")
+	}
+	if l.Value == nil {
+		return Metric{}, fmt.Errorf("invalid metric format. value is empty")
+	}
+	m := Metric{
+		Name:      l.Name,
+		Value:     *l.Value,
+		Timestamp: time.Now(),
+	}
+	if l.Time != nil {
+		m.Timestamp = time.Unix(int64(*l.Time), 0)
+	}
+	if len(l.Attributes) > 0 {
+		m.Attribute = &Attribute{Extra: l.Attributes}
+	}
+	return m, nil
+}
+
+// parsePrometheusMetricLine parses a sample line of the Prometheus text exposition format.
+// Labels are treated as attributes, and the timestamp (epoch milliseconds) is optional.
+// http_requests_total{method="post",code="200"} 1027 1395066363000
+func parsePrometheusMetricLine(b string) (Metric, error) {
+	b = strings.TrimSpace(b)
+	i := strings.IndexAny(b, "{ \t")
+	if i <= 0 {
+		return Metric{}, fmt.Errorf("invalid metric format. name or value is empty")
+	}
+	m := Metric{
+		Name:      b[:i],
+		Timestamp: time.Now(),
+	}
+	rest := b[i:]
+	if strings.HasPrefix(rest, "{") {
+		labels, r, err := parsePrometheusLabels(rest[1:])
+		if err != nil {
+			return m, err
+		}
+		if len(labels) > 0 {
+			m.Attribute = &Attribute{Extra: labels}
+		}
+		rest = r
+	}
+
+	cols := strings.Fields(rest)
+	if len(cols) == 0 || len(cols) > 2 {
+		return m, fmt.Errorf("invalid metric format. value and optional timestamp are required")
+	}
+	v, err := strconv.ParseFloat(cols[0], 64)
+	if err != nil {
+		return m, fmt.Errorf("invalid metric value: %s", cols[0])
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		// cannot be posted to Mackerel
+		return m, fmt.Errorf("metric value is not finite: %s", cols[0])
+	}
+	m.Value = v
+	if len(cols) == 2 {
+		ts, err := strconv.ParseInt(cols[1], 10, 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid metric time: %s", cols[1])
+		}
+		m.Timestamp = time.UnixMilli(ts)
+	}
+	return m, nil
+}
+
+// parsePrometheusLabels parses labels after "{" and returns them with the rest after "}".
+func parsePrometheusLabels(s string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return nil, "", fmt.Errorf("invalid metric labels")
+		}
+		key := strings.TrimSpace(s[:i])
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if key == "" || !strings.HasPrefix(s, `"`) {
+			return nil, "", fmt.Errorf("invalid metric labels")
+		}
+		s = s[1:]
+
+		var value strings.Builder
+		closed := false
+		for i = 0; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					value.WriteByte('\n')
+				} else {
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			if c == '"' {
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("invalid metric labels. unterminated value of %s", key)
+		}
+		labels[key] = value.String()
+		s = strings.TrimLeft(s[i+1:], " \t")
+		s = strings.TrimPrefix(s, ",")
+	}
+}
@@ -50,3 +50,121 @@ func TestParseMetricLine(t *testing.T) {
 		})
 	}
 }
+
+var jsonMetricTests = []struct {
+	input    string
+	expected maprobe.Metric
+}{
+	{
+		input:    `{"name":"foo.bar","value":42,"time":1755680137}`,
+		expected: maprobe.Metric{Name: "foo.bar", Value: 42, Timestamp: time.Unix(1755680137, 0)},
+	},
+	{
+		input: `{"name":"foo.bar.baz","value":42.123,"time":1755680137.888,"attributes":{"attr1":"value1","attr2":"value2"}}`,
+		expected: maprobe.Metric{
+			Name:      "foo.bar.baz",
+			Value:     float64(42.123),
+			Timestamp: time.Unix(1755680137, 0),
+			Attribute: &maprobe.Attribute{
+				Extra: map[string]string{
+					"attr1": "value1",
+					"attr2": "value2",
+				},
+			},
+		},
+	},
+}
+
+func TestParseJSONMetricLine(t *testing.T) {
+	for _, test := range jsonMetricTests {
+		t.Run(test.input, func(t *testing.T) {
+			m, err := maprobe.ParseJSONMetricLine(test.input)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, m); diff != "" {
+				t.Errorf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+	for _, input := range []string{``, `{}`, `{"name":"foo"}`, `{"value":1}`, `{"name":"foo","value":"x"}`} {
+		if _, err := maprobe.ParseJSONMetricLine(input); err == nil {
+			t.Errorf("%s: must be failed", input)
+		}
+	}
+	m, err := maprobe.ParseJSONMetricLine(`{"name":"foo","value":1}`)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if m.Timestamp.IsZero() {
+		t.Error("timestamp must be set to now when time is omitted")
+	}
+}
+
+var prometheusMetricTests = []struct {
+	input    string
+	expected maprobe.Metric
+}{
+	{
+		input:    "foo_bar 42 1755680137000",
+		expected: maprobe.Metric{Name: "foo_bar", Value: 42, Timestamp: time.Unix(1755680137, 0)},
+	},
+	{
+		input: `http_requests_total{method="post",code="200"} 1027 1755680137888`,
+		expected: maprobe.Metric{
+			Name:      "http_requests_total",
+			Value:     1027,
+			Timestamp: time.UnixMilli(1755680137888),
+			Attribute: &maprobe.Attribute{
+				Extra: map[string]string{
+					"method": "post",
+					"code":   "200",
+				},
+			},
+		},
+	},
+	{
+		input: `msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\"",} 1.458255915e9 1755680137000`,
+		expected: maprobe.Metric{
+			Name:      "msdos_file_access_time_seconds",
+			Value:     1.458255915e9,
+			Timestamp: time.Unix(1755680137, 0),
+			Attribute: &maprobe.Attribute{
+				Extra: map[string]string{
+					"path":  `C:\DIR\FILE.TXT`,
+					"error": "Cannot find file:\n\"FILE.TXT\"",
+				},
+			},
+		},
+	},
+}
+
+func TestParsePrometheusMetricLine(t *testing.T) {
+	for _, test := range prometheusMetricTests {
+		t.Run(test.input, func(t *testing.T) {
+			m, err := maprobe.ParsePrometheusMetricLine(test.input)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.expected, m); diff != "" {
+				t.Errorf("unexpected diff (-want +got):\n%s", diff)
+			}
+			t.Log(m.OtelString())
+		})
+	}
+	for _, input := range []string{
+		"",
+		"foo",
+		"foo x",
+		"foo 1 x",
+		"foo 1 2 3",
+		"foo NaN",
+		`foo{bar="baz} 1`,
+		`foo{bar=baz} 1`,
+		`{bar="baz"} 1`,
+	} {
+		if _, err := maprobe.ParsePrometheusMetricLine(input); err == nil {
+			t.Errorf("%s: must be failed", input)
+		}
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"math"
 	"net"
 	"time"
 
 	"fmt"
-	mackerel "github.com/mackerelio/mackerel-client-go"
 	fping "github.com/tatsushid/go-fastping"
 )
 
@@ -22,14 +22,25 @@ type PingProbeConfig struct {
 	Address         string        `yaml:"address"`
 	Count           int           `yaml:"count"`
 	Timeout         time.Duration `yaml:"timeout"`
+	IPVersion       int           `yaml:"ip_version"`
+	Size            int           `yaml:"size"`
+	Interval        time.Duration `yaml:"interval"`
+	Privileged      *bool         `yaml:"privileged"`
 	MetricKeyPrefix string        `yaml:"metric_key_prefix"`
 }
 
-func (pc *PingProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
+func (pc *PingProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
 	p := &PingProbe{
 		metricKeyPrefix: pc.MetricKeyPrefix,
 		Count:           pc.Count,
 		Timeout:         pc.Timeout,
+		IPVersion:       pc.IPVersion,
+		Size:            pc.Size,
+		Interval:        pc.Interval,
+		Privileged:      true,
+	}
+	if pc.Privileged != nil {
+		p.Privileged = *pc.Privileged
 	}
 	if addr, err := expandPlaceHolder(pc.Address, host, nil); err != nil {
 		return nil, err
@@ -40,6 +51,15 @@ func (pc *PingProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 		return nil, fmt.Errorf("no address")
 	}
 
+	switch p.IPVersion {
+	case 0, 4, 6:
+	default:
+		return nil, fmt.Errorf("invalid ip_version %d (4 or 6)", p.IPVersion)
+	}
+	if p.Size != 0 && p.Size < fping.TimeSliceLength {
+		return nil, fmt.Errorf("size must be greater than or equal to %d", fping.TimeSliceLength)
+	}
+
 	if p.Count == 0 {
 		p.Count = DefaultPingCount
 	}
@@ -55,9 +75,15 @@ func (pc *PingProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 type PingProbe struct {
 	metricKeyPrefix string
 
-	Address string
-	Count   int
-	Timeout time.Duration
+	Address   string
+	Count     int
+	Timeout   time.Duration
+	IPVersion int
+	Size      int
+	Interval  time.Duration
+
+	// Privileged prefers raw ICMP sockets to unprivileged ICMP datagram sockets.
+	Privileged bool
 }
 
 func (p *PingProbe) MetricName(name string) string {
@@ -73,22 +99,34 @@ func (p *PingProbe) Run(ctx context.Context) (Metrics, error) {
 	var ms Metrics
 
 	slog.Debug("run ping", "address", p.Address)
-	pinger := fping.NewPinger()
-	ipaddr, err := net.ResolveIPAddr("ip", p.Address)
+	network := "ip"
+	if p.IPVersion != 0 {
+		network = fmt.Sprintf("ip%d", p.IPVersion)
+	}
+	ipaddr, err := net.ResolveIPAddr(network, p.Address)
 	if err != nil {
 		ms = append(ms, newMetric(p, "count.success", 0))
 		ms = append(ms, newMetric(p, "count.failure", 1))
+		ms = append(ms, newMetric(p, "loss.percentage", 100))
 		return ms, fmt.Errorf("resolve failed: %w", err)
 	}
 	slog.Debug("address resolved", "address", p.Address, "ipaddr", ipaddr)
-	pinger.AddIPAddr(ipaddr)
+
+	privileged, err := p.selectICMPSocket(ipaddr)
+	if err != nil {
+		ms = append(ms, newMetric(p, "count.success", 0))
+		ms = append(ms, newMetric(p, "count.failure", 1))
+		ms = append(ms, newMetric(p, "loss.percentage", 100))
+		return ms, err
+	}
 
 	var min, max, total, avg time.Duration
-	var successCount, failureCount int
-	pinger.MaxRTT = p.Timeout
-	pinger.OnRecv = func(addr *net.IPAddr, rtt time.Duration) {
+	var successCount, failureCount, sentCount int
+	var rtts []time.Duration
+	onRecv := func(rtt time.Duration) {
 		slog.Debug("ping response received", "rtt", rtt)
 		successCount++
+		rtts = append(rtts, rtt)
 		if min == 0 || max == 0 {
 			min = rtt
 			max = rtt
@@ -101,13 +139,48 @@ func (p *PingProbe) Run(ctx context.Context) (Metrics, error) {
 		}
 		total = total + rtt
 	}
+
+	var run func() error
+	if privileged {
+		pinger := fping.NewPinger()
+		if p.Size != 0 {
+			pinger.Size = p.Size
+		}
+		pinger.AddIPAddr(ipaddr)
+		pinger.MaxRTT = p.Timeout
+		pinger.OnRecv = func(addr *net.IPAddr, rtt time.Duration) {
+			onRecv(rtt)
+		}
+		run = pinger.Run
+	} else {
+		size := p.Size
+		if size == 0 {
+			size = fping.TimeSliceLength
+		}
+		run = func() error {
+			rtt, received, err := pingDatagram(ipaddr, size, p.Timeout, sentCount)
+			if received {
+				onRecv(rtt)
+			}
+			return err
+		}
+	}
+
 	for i := 0; i < p.Count; i++ {
+		if i > 0 && p.Interval > 0 {
+			select {
+			case <-ctx.Done():
+				return ms, nil
+			case <-time.After(p.Interval):
+			}
+		}
 		select {
 		case <-ctx.Done():
 			return ms, nil
 		default:
 		}
-		err := pinger.Run()
+		sentCount++
+		err := run()
 		if err != nil {
 			failureCount++
 			slog.Warn("ping failed", "address", p.Address, "ipaddr", ipaddr, "error", err)
@@ -119,12 +192,27 @@ func (p *PingProbe) Run(ctx context.Context) (Metrics, error) {
 
 	ms = append(ms, newMetric(p, "count.success", float64(successCount)))
 	ms = append(ms, newMetric(p, "count.failure", float64(failureCount)))
+	ms = append(ms, newMetric(p, "loss.percentage", float64(sentCount-successCount)/float64(sentCount)*100))
 	if min > 0 || max > 0 || avg > 0 {
 		ms = append(ms, newMetric(p, "rtt.min", min.Seconds()))
 		ms = append(ms, newMetric(p, "rtt.max", max.Seconds()))
 		ms = append(ms, newMetric(p, "rtt.avg", avg.Seconds()))
+		ms = append(ms, newMetric(p, "rtt.stddev", rttStddev(rtts, avg).Seconds()))
 	}
 	slog.Debug("ping probe completed", "metrics", ms.String())
 
 	return ms, nil
 }
+
+// rttStddev returns the population standard deviation of RTTs.
+func rttStddev(rtts []time.Duration, avg time.Duration) time.Duration {
+	if len(rtts) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, rtt := range rtts {
+		d := float64(rtt - avg)
+		sum += d * d
+	}
+	return time.Duration(math.Sqrt(sum / float64(len(rtts))))
+}
@@ -0,0 +1,103 @@
+package maprobe
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+)
+
+// icmpListenNetwork returns the network and the address to listen ICMP for the IP address.
+func icmpListenNetwork(ip net.IP, privileged bool) (string, string) {
+	switch {
+	case ip.To4() != nil && privileged:
+		return "ip4:icmp", "0.0.0.0"
+	case ip.To4() != nil:
+		return "udp4", "0.0.0.0"
+	case privileged:
+		return "ip6:ipv6-icmp", "::"
+	default:
+		return "udp6", "::"
+	}
+}
+
+// selectICMPSocket returns whether the raw ICMP socket (true) or the ICMP datagram socket (false) is used.
+// The socket preferred by Privileged is tried first, and the other is used as a fallback.
+func (p *PingProbe) selectICMPSocket(ipaddr *net.IPAddr) (bool, error) {
+	var errs []error
+	for _, privileged := range []bool{p.Privileged, !p.Privileged} {
+		network, address := icmpListenNetwork(ipaddr.IP, privileged)
+		conn, err := icmp.ListenPacket(network, address)
+		if err == nil {
+			conn.Close()
+			if privileged != p.Privileged {
+				slog.Debug("ICMP socket falls back", "network", network, "error", errors.Join(errs...))
+			}
+			return privileged, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", network, err))
+	}
+	return false, fmt.Errorf("no ICMP socket is available. raw sockets require root or CAP_NET_RAW, "+
+		"and datagram sockets require the group of the process in net.ipv4.ping_group_range: %w", errors.Join(errs...))
+}
+
+// pingDatagram sends an ICMP echo request by the unprivileged ICMP datagram socket, and waits the reply until the timeout.
+// The kernel rewrites the ID of the echo by the socket, so replies to other sockets are not received.
+func pingDatagram(ipaddr *net.IPAddr, size int, timeout time.Duration, seq int) (time.Duration, bool, error) {
+	network, address := icmpListenNetwork(ipaddr.IP, false)
+	conn, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	proto := protocolICMP
+	if ipaddr.IP.To4() == nil {
+		typ, proto = ipv6.ICMPTypeEchoRequest, protocolIPv6ICMP
+	}
+	b, err := (&icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{Seq: seq, Data: make([]byte, size)},
+	}).Marshal(nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(timeout))
+	if _, err := conn.WriteTo(b, &net.UDPAddr{IP: ipaddr.IP, Zone: ipaddr.Zone}); err != nil {
+		return 0, false, err
+	}
+	buf := make([]byte, size+1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, false, nil
+			}
+			return 0, false, err
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		if m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		if echo, ok := m.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return time.Since(start), true, nil
+		}
+	}
+}
@@ -19,7 +19,7 @@ var pingProbesConfig = []*maprobe.PingProbeConfig{
 
 func TestPing(t *testing.T) {
 	for _, pc := range pingProbesConfig {
-		probe, _ := pc.GenerateProbe(&mackerel.Host{ID: "test"})
+		probe, _ := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
 		ms, err := probe.Run(context.Background())
 		if err != nil {
 			t.Error(err)
@@ -27,3 +27,77 @@ func TestPing(t *testing.T) {
 		t.Log(ms.String())
 	}
 }
+
+func TestPingOptions(t *testing.T) {
+	configs := []*maprobe.PingProbeConfig{
+		{Address: "127.0.0.1", Count: 3, Timeout: pingTimeout, IPVersion: 4, Size: 64, Interval: 10 * time.Millisecond},
+		{Address: "::1", Count: 3, Timeout: pingTimeout, IPVersion: 6, Size: 8},
+		{Address: "localhost", Count: 3, Timeout: pingTimeout, IPVersion: 4},
+	}
+	for _, pc := range configs {
+		probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms, err := probe.Run(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		found := map[string]bool{}
+		for _, m := range ms {
+			found[m.Name] = true
+			switch m.Name {
+			case "ping.loss.percentage":
+				if m.Value != 0 {
+					t.Errorf("unexpected %s %f", m.Name, m.Value)
+				}
+			case "ping.rtt.stddev":
+				if m.Value < 0 || m.Value > pingTimeout.Seconds() {
+					t.Errorf("unexpected %s %f", m.Name, m.Value)
+				}
+			}
+		}
+		if !found["ping.loss.percentage"] {
+			t.Error("metric ping.loss.percentage not found")
+		}
+		if found["ping.rtt.avg"] && !found["ping.rtt.stddev"] {
+			t.Error("metric ping.rtt.stddev not found")
+		}
+		t.Log(ms.String())
+	}
+}
+
+func TestPingInvalid(t *testing.T) {
+	configs := []*maprobe.PingProbeConfig{
+		{},
+		{Address: "127.0.0.1", IPVersion: 5},
+		{Address: "127.0.0.1", Size: 4},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}
+
+func TestPingUnprivileged(t *testing.T) {
+	// falls back to raw sockets when datagram sockets are not permitted by net.ipv4.ping_group_range
+	privileged := false
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		pc := &maprobe.PingProbeConfig{Address: addr, Count: 2, Timeout: pingTimeout, Privileged: &privileged}
+		probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms, err := probe.Run(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		for _, m := range ms {
+			if m.Name == "ping.count.success" && m.Value != 2 {
+				t.Errorf("unexpected %s %f", m.Name, m.Value)
+			}
+		}
+		t.Log(ms.String())
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -27,7 +29,7 @@ func newMetric(p Probe, name string, value float64) Metric {
 }
 
 type ProbeConfig interface {
-	GenerateProbe(host *mackerel.Host) (Probe, error)
+	GenerateProbe(host *ProbeHost) (Probe, error)
 }
 
 var (
@@ -35,7 +37,7 @@ var (
 )
 
 func newFuncMap(env map[string]string) template.FuncMap {
-	return template.FuncMap{
+	fm := template.FuncMap{
 		"env": func(keys ...string) string {
 			v := ""
 			for _, k := range keys {
@@ -58,6 +60,10 @@ func newFuncMap(env map[string]string) template.FuncMap {
 			panic(fmt.Sprintf("environment variable %s is not defined", key))
 		},
 	}
+	for name, f := range secretFuncMap() {
+		fm[name] = f
+	}
+	return fm
 }
 
 func expandCacheKey(src string, env map[string]string) string {
@@ -67,7 +73,40 @@ func expandCacheKey(src string, env map[string]string) string {
 	return fmt.Sprintf("%s%s", env, src)
 }
 
-func expandPlaceHolder(src string, host *mackerel.Host, env map[string]string) (string, error) {
+// ProbeHost represents a host to probe with the values available in templates other than {{ .Host }}.
+type ProbeHost struct {
+	*mackerel.Host
+
+	Target          *Target        // {{ .Target }}, nil for Mackerel hosts
+	Metadata        map[string]any // {{ .Metadata }}
+	ServiceMetadata map[string]any // {{ .ServiceMetadata }}
+	RoleMetadata    map[string]any // {{ .RoleMetadata }}
+}
+
+func newTemplateParam(host *ProbeHost, vars map[string]string) templateParam {
+	if host == nil {
+		return templateParam{Vars: vars}
+	}
+	return templateParam{
+		Host:            host.Host,
+		Target:          host.Target,
+		Metadata:        host.Metadata,
+		ServiceMetadata: host.ServiceMetadata,
+		RoleMetadata:    host.RoleMetadata,
+		Vars:            vars,
+	}
+}
+
+func expandPlaceHolder(src string, host *ProbeHost, env map[string]string) (string, error) {
+	return expandTemplate(src, newTemplateParam(host, nil), env)
+}
+
+// expandPlaceHolderWithVars expands src with the host and variables accessible as {{ .Vars.name }}.
+func expandPlaceHolderWithVars(src string, host *ProbeHost, vars map[string]string) (string, error) {
+	return expandTemplate(src, newTemplateParam(host, vars), nil)
+}
+
+func expandTemplate(src string, param templateParam, env map[string]string) (string, error) {
 	var err error
 
 	if !strings.Contains(src, "{{") {
@@ -90,7 +129,7 @@ func expandPlaceHolder(src string, host *mackerel.Host, env map[string]string) (
 	}
 	var b strings.Builder
 	b.Grow(len(src))
-	err = tmpl.Execute(&b, templateParam{Host: host})
+	err = tmpl.Execute(&b, param)
 	return b.String(), err
 }
 
@@ -101,48 +140,80 @@ func (pd *ProbeDefinition) RunProbes(ctx context.Context, client *Client, chs *C
 			chs.SendServiceMetric(m)
 		}
 	} else {
-		for _, m := range pd.RunHostProbes(ctx, client, stats) {
+		ms, reports := pd.RunHostProbes(ctx, client, stats)
+		for _, m := range ms {
 			chs.SendHostMetric(m)
 		}
+		for _, r := range reports {
+			chs.SendCheckReport(r)
+		}
 	}
 }
 
-func (pd *ProbeDefinition) RunHostProbes(ctx context.Context, client *Client, stats *StatsCollector) []HostMetric {
+func (pd *ProbeDefinition) RunHostProbes(ctx context.Context, client *Client, stats *StatsCollector) ([]HostMetric, []*mackerel.CheckReport) {
 	slog.Debug("probes finding hosts", "service", pd.Service, "roles", pd.Roles, "statuses", pd.Statuses)
 	roles := exStrings(pd.Roles)
 	statuses := exStrings(pd.Statuses)
 	ms := []HostMetric{}
+	reports := []*mackerel.CheckReport{}
 
-	hosts, err := client.FindHosts(&mackerel.FindHostsParam{
-		Service:  pd.Service.String(),
-		Roles:    roles,
-		Statuses: statuses,
-	})
-	if err != nil {
-		slog.Error("probes find host failed", "error", err)
-		return nil
+	var hosts []*ProbeHost
+	if pd.Targets != nil {
+		var err error
+		hosts, err = pd.Targets.findHosts(ctx)
+		if err != nil {
+			slog.Error("probes find targets failed", "error", err)
+			return nil, nil
+		}
+	} else {
+		mhosts, err := client.FindHosts(&mackerel.FindHostsParam{
+			Service:  pd.Service.String(),
+			Roles:    roles,
+			Statuses: statuses,
+		})
+		if err != nil {
+			slog.Error("probes find host failed", "error", err)
+			return nil, nil
+		}
+		hosts = make([]*ProbeHost, 0, len(mhosts))
+		for _, h := range mhosts {
+			hosts = append(hosts, &ProbeHost{Host: h})
+		}
 	}
 	slog.Debug("probes hosts found", "count", len(hosts))
-	// Update target hosts count for stats
-	stats.SetTargetCounts(int64(len(hosts)), 0)
+	if currentShard.Enabled() {
+		hosts = slices.DeleteFunc(hosts, func(h *ProbeHost) bool {
+			return !currentShard.Owns(h.ID)
+		})
+		slog.Debug("probes hosts in the shard", "count", len(hosts), "shard", currentShard.String())
+	}
 	if len(hosts) == 0 {
-		return nil
+		stats.SetTargetCounts(0, 0)
+		return nil, nil
 	}
 
-	spawnInterval := time.Duration(int64(ProbeInterval) / int64(len(hosts)) / 2)
+	spawnInterval := time.Duration(int64(pd.interval()) / int64(len(hosts)) / 2)
 	if spawnInterval > time.Second {
 		spawnInterval = time.Second
 	}
 
 	wg := &sync.WaitGroup{}
+	var mu sync.Mutex // guards ms and reports
+	var probed atomic.Int64
 	for _, host := range hosts {
 		time.Sleep(spawnInterval)
 		slog.Debug("probes preparing host", "hostID", host.ID, "hostName", host.Name)
 		wg.Add(1)
-		go func(host *mackerel.Host) {
+		go func(host *ProbeHost) {
 			lock()
 			defer unlock()
 			defer wg.Done()
+			// filters may fetch metadata, so they are evaluated in the limit of concurrency
+			if !pd.filterHost(host, client) {
+				return
+			}
+			probed.Add(1)
+			host = pd.withMetadata(host, client)
 			for _, probe := range pd.GenerateProbes(host, client.mackerel) {
 				slog.Debug("probing host", "hostID", host.ID, "hostName", host.Name, "probe", probe)
 				metrics, err := probe.Run(ctx)
@@ -152,6 +223,10 @@ func (pd *ProbeDefinition) RunHostProbes(ctx context.Context, client *Client, st
 					slog.Warn("probe failed", "error", err, "hostID", host.ID, "hostName", host.Name, "probe", probe)
 				}
 				stats.RecordProbeExecution(ctx, probe, err)
+				mu.Lock()
+				if r, ok := probe.(CheckReporter); ok && r.CheckReport() != nil {
+					reports = append(reports, r.CheckReport())
+				}
 				for _, m := range metrics {
 					if m.Attribute == nil {
 						m.Attribute = &Attribute{}
@@ -159,29 +234,62 @@ func (pd *ProbeDefinition) RunHostProbes(ctx context.Context, client *Client, st
 					m.Attribute.Service = pd.Service.String()
 					m.Attribute.HostID = host.ID
 					m.Attribute.SetExtra(pd.Attributes, host)
+					if pd.Targets != nil {
+						// targets are not Mackerel hosts
+						m.OtelOnly = true
+					}
 					ms = append(ms, m.HostMetric(host.ID))
 
 					// Update metrics collected counter
 					stats.RecordMetricCollected(ctx)
 				}
+				mu.Unlock()
 			}
 		}(host)
 	}
 	wg.Wait()
-	return ms
+	// Update target hosts count for stats
+	stats.SetTargetCounts(probed.Load(), 0)
+	return ms, reports
 }
 
 func (pd *ProbeDefinition) RunServiceProbes(ctx context.Context, client *Client, stats *StatsCollector) []ServiceMetric {
 	serviceName := pd.Service.String()
 	slog.Debug("probes for service metric", "service", serviceName)
-	// Update target services count for stats (set to 1 for this service)
-	stats.SetTargetCounts(0, 1)
+	if pd.Targets == nil {
+		// Update target services count for stats (set to 1 for this service)
+		stats.SetTargetCounts(0, 1)
+		host := &ProbeHost{Host: &mackerel.Host{
+			Name: serviceName,
+			ID:   serviceName,
+		}}
+		return pd.runServiceProbes(ctx, client, stats, host, "")
+	}
+
+	hosts, err := pd.Targets.findHosts(ctx)
+	if err != nil {
+		slog.Error("probes find targets failed", "error", err)
+		return nil
+	}
+	// targets have no metadata to fetch, so filters are evaluated before probing
+	hosts = slices.DeleteFunc(hosts, func(h *ProbeHost) bool {
+		return !pd.filterHost(h, client)
+	})
+	stats.SetTargetCounts(int64(len(hosts)), 1)
+	ms := []ServiceMetric{}
+	for _, host := range hosts {
+		// metrics of targets are distinguished by the suffix of the names
+		suffix := "." + checkMetricNameInvalidChars.ReplaceAllString(host.ID, "_")
+		ms = append(ms, pd.runServiceProbes(ctx, client, stats, host, suffix)...)
+	}
+	return ms
+}
+
+func (pd *ProbeDefinition) runServiceProbes(ctx context.Context, client *Client, stats *StatsCollector, host *ProbeHost, suffix string) []ServiceMetric {
+	serviceName := pd.Service.String()
 	lock()
 	defer unlock()
-	host := &mackerel.Host{
-		Name: serviceName,
-		ID:   serviceName,
-	}
+	host = pd.withMetadata(host, client)
 	ms := []ServiceMetric{}
 	for _, probe := range pd.GenerateProbes(host, client.mackerel) {
 		slog.Debug("probing service", "service", serviceName, "probe", probe)
@@ -196,6 +304,7 @@ func (pd *ProbeDefinition) RunServiceProbes(ctx context.Context, client *Client,
 			if m.Attribute == nil {
 				m.Attribute = &Attribute{}
 			}
+			m.Name += suffix
 			m.Attribute.Service = serviceName
 			m.Attribute.SetExtra(pd.Attributes, host)
 			ms = append(ms, m.ServiceMetric(serviceName))
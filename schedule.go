@@ -0,0 +1,256 @@
+package maprobe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// minInterval is the minimum interval of schedules.
+const minInterval = time.Second
+
+// ScheduleConfig represents when probes or aggregates run.
+// When neither interval nor cron is specified, they run every ProbeInterval.
+// Each run must finish by the deadline, which defaults to the next scheduled time.
+type ScheduleConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Cron     string        `yaml:"cron"`
+	Deadline time.Duration `yaml:"deadline"`
+
+	cronSchedule cron.Schedule
+}
+
+func (s *ScheduleConfig) initialize() error {
+	if s.Interval != 0 && s.Cron != "" {
+		return fmt.Errorf("interval and cron are exclusive")
+	}
+	if s.Interval < 0 || (s.Interval > 0 && s.Interval < minInterval) {
+		return fmt.Errorf("invalid interval %s, must be at least %s", s.Interval, minInterval)
+	}
+	if s.Deadline < 0 {
+		return fmt.Errorf("invalid deadline %s", s.Deadline)
+	}
+	if s.Cron != "" {
+		sc, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid cron %q: %w", s.Cron, err)
+		}
+		s.cronSchedule = sc
+	}
+	return nil
+}
+
+// equal reports whether s and o schedule runs at the same times.
+func (s *ScheduleConfig) equal(o *ScheduleConfig) bool {
+	return s.Interval == o.Interval && s.Cron == o.Cron && s.Deadline == o.Deadline
+}
+
+// interval returns the (approximate for cron) interval between runs.
+func (s *ScheduleConfig) interval() time.Duration {
+	if s.cronSchedule != nil {
+		next := s.cronSchedule.Next(time.Now())
+		return s.cronSchedule.Next(next).Sub(next)
+	}
+	if s.Interval > 0 {
+		return s.Interval
+	}
+	return ProbeInterval
+}
+
+// first returns the time of the first run after now.
+// Interval schedules run immediately, and cron schedules run at the next matched time.
+func (s *ScheduleConfig) first(now time.Time) time.Time {
+	if s.cronSchedule != nil {
+		return s.cronSchedule.Next(now)
+	}
+	return now
+}
+
+// next returns the time of the run after the scheduled run at prev.
+// Runs missed until now are skipped.
+func (s *ScheduleConfig) next(prev, now time.Time) time.Time {
+	if s.cronSchedule != nil {
+		return s.cronSchedule.Next(now)
+	}
+	interval := s.interval()
+	if !now.Before(prev) {
+		// skip the runs missed until now at once
+		n := now.Sub(prev)/interval + 1
+		return prev.Add(n * interval)
+	}
+	return prev.Add(interval)
+}
+
+// deadline returns the deadline of the run started at start.
+func (s *ScheduleConfig) deadline(start, next time.Time) time.Time {
+	if s.Deadline > 0 {
+		return start.Add(s.Deadline)
+	}
+	return next
+}
+
+// onceDeadline returns the deadline of the run started at start by once mode.
+// It returns zero time unless deadline is specified, because there is no next run to be blocked.
+func (s *ScheduleConfig) onceDeadline(start time.Time) time.Time {
+	if s.Deadline > 0 {
+		return start.Add(s.Deadline)
+	}
+	return time.Time{}
+}
+
+// job is a probe or an aggregate definition scheduled independently.
+type job struct {
+	name     string
+	digest   string
+	schedule *ScheduleConfig
+	run      func(ctx context.Context, wg *sync.WaitGroup)
+	stats    *StatsCollector
+	next     time.Time
+	running  *atomic.Bool
+}
+
+// newJobs returns jobs of the config.
+// The previous jobs are matched by the digests of the definitions, not by the positions.
+// When the definition and the schedule are not changed, the state of the previous job is carried over.
+// When only the schedule is changed, the schedule is reset but the running flag is carried over,
+// so that a reloaded job does not overlap the run of the previous job.
+func newJobs(conf *Config, client *Client, chs *Channels, stats *StatsCollector, now time.Time, prev []*job) []*job {
+	jobs := make([]*job, 0, len(conf.Probes)+len(conf.Aggregates))
+	for i, pd := range conf.Probes {
+		name := fmt.Sprintf("probes[%d]", i)
+		if pd.IsServiceMetric && !currentShard.Owns(name) {
+			// service metric probes run in exactly one shard
+			slog.Debug("skipping a job of another shard", "job", name, "shard", currentShard.String())
+			continue
+		}
+		jobs = append(jobs, &job{
+			name:     name,
+			digest:   definitionDigest("probe", pd),
+			schedule: &pd.ScheduleConfig,
+			run: func(ctx context.Context, wg *sync.WaitGroup) {
+				pd.RunProbes(ctx, client, chs, stats, wg)
+			},
+		})
+	}
+	for i, ag := range conf.Aggregates {
+		name := fmt.Sprintf("aggregates[%d]", i)
+		if !currentShard.Owns(name) {
+			slog.Debug("skipping a job of another shard", "job", name, "shard", currentShard.String())
+			continue
+		}
+		jobs = append(jobs, &job{
+			name:     name,
+			digest:   definitionDigest("aggregate", ag),
+			schedule: &ag.ScheduleConfig,
+			run: func(ctx context.Context, wg *sync.WaitGroup) {
+				runAggregates(ctx, ag, client, chs, wg)
+			},
+		})
+	}
+	prevJobs := make(map[string][]*job, len(prev))
+	for _, j := range prev {
+		prevJobs[j.digest] = append(prevJobs[j.digest], j)
+	}
+	for _, j := range jobs {
+		j.stats = stats
+		pjs := prevJobs[j.digest]
+		if len(pjs) == 0 {
+			j.next = j.schedule.first(now)
+			j.running = new(atomic.Bool)
+			continue
+		}
+		// identical definitions are matched in order
+		pj := pjs[0]
+		prevJobs[j.digest] = pjs[1:]
+		j.running = pj.running
+		if j.schedule.equal(pj.schedule) {
+			j.next = pj.next
+			continue
+		}
+		j.next = j.schedule.first(now)
+		if pj.next.Before(j.next) {
+			j.next = pj.next
+		}
+	}
+	return jobs
+}
+
+// definitionDigest returns the digest of the definition.
+// The schedule is not included, because ScheduleConfig is not marshaled to JSON.
+func definitionDigest(kind string, def any) string {
+	b, _ := json.Marshal(def)
+	s := sha256.Sum256(b)
+	return fmt.Sprintf("%s:%x", kind, s)
+}
+
+// start runs the job in background when the job is due and not running.
+// The previous run which is still running is not overlapped,
+// and the run is canceled at the deadline so that it does not block other jobs.
+func (j *job) start(ctx context.Context, wg *sync.WaitGroup, now time.Time) {
+	if now.Before(j.next) {
+		return
+	}
+	j.next = j.schedule.next(j.next, now)
+	if !j.running.CompareAndSwap(false, true) {
+		slog.Warn("skipping a run because the previous run is still running", "job", j.name, "next", j.next)
+		j.stats.RecordSkippedCycle(ctx, j.name)
+		return
+	}
+	deadline := j.schedule.deadline(now, j.next)
+	slog.Debug("starting a job", "job", j.name, "deadline", deadline, "next", j.next)
+	j.launch(ctx, wg, now, deadline)
+}
+
+// startOnce runs the job in background regardless of the schedule.
+func (j *job) startOnce(ctx context.Context, wg *sync.WaitGroup, now time.Time) {
+	j.running.Store(true)
+	deadline := j.schedule.onceDeadline(now)
+	slog.Debug("starting a job once", "job", j.name, "deadline", deadline)
+	j.launch(ctx, wg, now, deadline)
+}
+
+// launch runs the job in background until the deadline. A zero deadline means no deadline.
+func (j *job) launch(ctx context.Context, wg *sync.WaitGroup, now, deadline time.Time) {
+	var jwg sync.WaitGroup
+	jwg.Add(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer j.running.Store(false)
+		var runCtx context.Context
+		var cancel context.CancelFunc
+		if deadline.IsZero() {
+			runCtx, cancel = context.WithCancel(ctx)
+		} else {
+			runCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		defer cancel()
+		j.run(runCtx, &jwg)
+		jwg.Wait()
+
+		elapsed := time.Since(now)
+		overrun := !deadline.IsZero() && time.Now().After(deadline)
+		if overrun {
+			slog.Warn("cycle overrun. the run did not finish by the deadline", "job", j.name, "elapsed", elapsed, "deadline", deadline)
+		}
+		j.stats.RecordCycle(ctx, j.name, elapsed, overrun)
+	}()
+}
+
+// nextRun returns the earliest time when any of the jobs is due.
+func nextRun(jobs []*job, limit time.Time) time.Time {
+	next := limit
+	for _, j := range jobs {
+		if j.next.Before(next) {
+			next = j.next
+		}
+	}
+	return next
+}
@@ -0,0 +1,197 @@
+package maprobe_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/maprobe"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2025, 8, 20, 12, 34, 56, 0, time.Local)
+	tests := []struct {
+		name  string
+		sc    maprobe.ScheduleConfig
+		first time.Time
+		next  time.Time // after the first run, when now is 90 seconds after the first run
+	}{
+		{
+			name:  "default",
+			sc:    maprobe.ScheduleConfig{},
+			first: now,
+			next:  now.Add(2 * maprobe.ProbeInterval),
+		},
+		{
+			name:  "interval",
+			sc:    maprobe.ScheduleConfig{Interval: 10 * time.Second},
+			first: now,
+			next:  now.Add(100 * time.Second),
+		},
+		{
+			name:  "cron",
+			sc:    maprobe.ScheduleConfig{Cron: "*/5 * * * *"},
+			first: time.Date(2025, 8, 20, 12, 35, 0, 0, time.Local),
+			next:  time.Date(2025, 8, 20, 12, 40, 0, 0, time.Local),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := tt.sc
+			if err := sc.Initialize(); err != nil {
+				t.Fatal(err)
+			}
+			first := sc.First(now)
+			if !first.Equal(tt.first) {
+				t.Errorf("unexpected first run %s, want %s", first, tt.first)
+			}
+			if next := sc.Next(first, first.Add(90*time.Second)); !next.Equal(tt.next) {
+				t.Errorf("unexpected next run %s, want %s", next, tt.next)
+			}
+		})
+	}
+}
+
+func TestScheduleNextAfterOverrun(t *testing.T) {
+	prev := time.Date(2025, 8, 20, 12, 34, 56, 0, time.Local)
+	sc := maprobe.ScheduleConfig{Interval: time.Second}
+	if err := sc.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		now  time.Time
+		next time.Time
+	}{
+		{now: prev, next: prev.Add(time.Second)},
+		{now: prev.Add(500 * time.Millisecond), next: prev.Add(time.Second)},
+		{now: prev.Add(time.Second), next: prev.Add(2 * time.Second)},
+		{now: prev.Add(240*time.Hour + 500*time.Millisecond), next: prev.Add(240*time.Hour + time.Second)},
+	} {
+		if next := sc.Next(prev, tt.now); !next.Equal(tt.next) {
+			t.Errorf("unexpected next run %s at %s, want %s", next, tt.now, tt.next)
+		}
+	}
+}
+
+func TestScheduleDeadline(t *testing.T) {
+	now := time.Date(2025, 8, 20, 12, 34, 56, 0, time.Local)
+	next := now.Add(time.Minute)
+
+	sc := maprobe.ScheduleConfig{}
+	if d := sc.RunDeadline(now, next); !d.Equal(next) {
+		t.Errorf("unexpected default deadline %s, want %s", d, next)
+	}
+	if d := sc.OnceDeadline(now); !d.IsZero() {
+		t.Errorf("unexpected default deadline of once %s, want no deadline", d)
+	}
+	sc = maprobe.ScheduleConfig{Deadline: 10 * time.Second}
+	if d := sc.RunDeadline(now, next); !d.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("unexpected deadline %s", d)
+	}
+	if d := sc.OnceDeadline(now); !d.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("unexpected deadline of once %s", d)
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	configs := []maprobe.ScheduleConfig{
+		{Interval: -1 * time.Second},
+		{Interval: time.Nanosecond},
+		{Interval: 999 * time.Millisecond},
+		{Cron: "* * *"},
+		{Interval: time.Minute, Cron: "* * * * *"},
+		{Deadline: -1 * time.Second},
+	}
+	for _, sc := range configs {
+		if err := sc.Initialize(); err == nil {
+			t.Errorf("must be failed %#v", sc)
+		}
+	}
+}
+
+func TestScheduleConfig(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`
+apikey: dummy
+probes:
+  - service: prod
+    interval: 10s
+    deadline: 5s
+    ping:
+      address: 127.0.0.1
+aggregates:
+  - service: prod
+    cron: "0 * * * *"
+    metrics: []
+`)
+	f.Close()
+	c, _, err := maprobe.LoadConfig(context.Background(), f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Probes[0].Interval != 10*time.Second {
+		t.Errorf("unexpected interval %s", c.Probes[0].Interval)
+	}
+	if c.Probes[0].Deadline != 5*time.Second {
+		t.Errorf("unexpected deadline %s", c.Probes[0].Deadline)
+	}
+	if c.Aggregates[0].Cron != "0 * * * *" {
+		t.Errorf("unexpected cron %s", c.Aggregates[0].Cron)
+	}
+}
+
+func TestJobsReload(t *testing.T) {
+	now := time.Date(2025, 8, 20, 12, 34, 56, 0, time.Local)
+	conf := &maprobe.Config{
+		Probes: []*maprobe.ProbeDefinition{
+			{Ping: &maprobe.PingProbeConfig{Address: "127.0.0.1"}},
+			{Ping: &maprobe.PingProbeConfig{Address: "127.0.0.2"}, ScheduleConfig: maprobe.ScheduleConfig{Cron: "0 0 * * *"}},
+		},
+	}
+	if err := conf.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	jobs := maprobe.NewJobs(conf, now, nil)
+	if len(jobs) != 2 {
+		t.Fatalf("unexpected jobs %d", len(jobs))
+	}
+	jobs[0].Running().Store(true) // the previous runs are still running
+	jobs[1].Running().Store(true)
+
+	reloaded := now.Add(maprobe.ProbeInterval)
+	conf = &maprobe.Config{
+		Probes: []*maprobe.ProbeDefinition{
+			// inserted before the existing definitions
+			{Ping: &maprobe.PingProbeConfig{Address: "127.0.0.3"}},
+			// not changed
+			{Ping: &maprobe.PingProbeConfig{Address: "127.0.0.1"}},
+			// the schedule is changed
+			{Ping: &maprobe.PingProbeConfig{Address: "127.0.0.2"}, ScheduleConfig: maprobe.ScheduleConfig{Interval: 10 * time.Second}},
+		},
+	}
+	if err := conf.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	newJobs := maprobe.NewJobs(conf, reloaded, jobs)
+	if len(newJobs) != 3 {
+		t.Fatalf("unexpected jobs %d", len(newJobs))
+	}
+	if j := newJobs[0]; j.Running().Load() || !j.NextRun().Equal(reloaded) {
+		t.Errorf("unexpected state of the new job %s: running %v next %s", j.Name(), j.Running().Load(), j.NextRun())
+	}
+	if j := newJobs[1]; !j.Running().Load() || !j.NextRun().Equal(now) {
+		t.Errorf("state of the unchanged job %s is not carried over: running %v next %s", j.Name(), j.Running().Load(), j.NextRun())
+	}
+	if j := newJobs[2]; !j.Running().Load() || !j.NextRun().Equal(reloaded) {
+		t.Errorf("schedule of the changed job %s is not reset: running %v next %s", j.Name(), j.Running().Load(), j.NextRun())
+	}
+
+	jobs[0].Running().Store(false) // the previous run finished
+	if newJobs[1].Running().Load() {
+		t.Error("running flag is not shared with the previous job")
+	}
+}
@@ -0,0 +1,251 @@
+package maprobe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/goccy/go-yaml"
+)
+
+var (
+	// SecretCacheTTL is the duration to cache secrets referenced by templates.
+	SecretCacheTTL = time.Minute
+	// SecretTimeout is the timeout to fetch a secret.
+	SecretTimeout = 10 * time.Second
+	// SecretsFile is a file used instead of SSM parameter store and Secrets Manager (for local testing).
+	SecretsFile string
+)
+
+// secretRedactMinLength is the min length of secrets redacted in logs.
+// Shorter values are not redacted to keep logs readable.
+const secretRedactMinLength = 4
+
+const secretRedacted = "[REDACTED]"
+
+var secretCache sync.Map // kind + "/" + name -> *secretCacheEntry
+
+type secretCacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+// secretValues holds the values of secrets to redact in logs.
+var secretValues sync.Map // value -> struct{}
+
+// secretFuncMap returns template functions to reference secrets.
+func secretFuncMap() map[string]any {
+	return map[string]any{
+		"ssm": func(name string) (string, error) {
+			return getSecret("ssm", name, func(ctx context.Context) (string, error) {
+				if SecretsFile != "" {
+					return getSecretFromFile("ssm", name)
+				}
+				return GetSSMParameter(ctx, name)
+			})
+		},
+		"secretsmanager": func(id string, keys ...string) (string, error) {
+			v, err := getSecret("secretsmanager", id, func(ctx context.Context) (string, error) {
+				if SecretsFile != "" {
+					return getSecretFromFile("secretsmanager", id)
+				}
+				return GetSecretsManagerSecret(ctx, id)
+			})
+			if err != nil || len(keys) == 0 {
+				return v, err
+			}
+			return lookupSecretKey(v, keys[0])
+		},
+		"file": func(path string) (string, error) {
+			return getSecret("file", path, func(_ context.Context) (string, error) {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return "", err
+				}
+				return strings.TrimRight(string(b), "\r\n"), nil
+			})
+		},
+	}
+}
+
+// getSecret returns the secret cached for SecretCacheTTL.
+// When fetching the secret failed, the previous cache is used.
+func getSecret(kind, name string, fetch func(ctx context.Context) (string, error)) (string, error) {
+	key := kind + "/" + name
+	cached, found := secretCache.Load(key)
+	if found {
+		if e := cached.(*secretCacheEntry); time.Now().Before(e.expires) {
+			return e.value, nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), SecretTimeout)
+	defer cancel()
+	v, err := fetch(ctx)
+	if err != nil {
+		if found {
+			slog.Warn("get secret failed, using previous cache", "kind", kind, "name", name, "error", err)
+			return cached.(*secretCacheEntry).value, nil
+		}
+		return "", fmt.Errorf("failed to get secret %s %s: %w", kind, name, err)
+	}
+	addSecretValue(v)
+	secretCache.Store(key, &secretCacheEntry{
+		value:   v,
+		expires: time.Now().Add(SecretCacheTTL),
+	})
+	return v, nil
+}
+
+// lookupSecretKey returns the value of the key in the JSON secret.
+func lookupSecretKey(secret, key string) (string, error) {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(secret), &m); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	v, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("key %s is not found in the secret", key)
+	}
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	default:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	addSecretValue(s)
+	return s, nil
+}
+
+func GetSecretsManagerSecret(ctx context.Context, id string) (string, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	svc := secretsmanager.NewFromConfig(cfg)
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+	if result.SecretString != nil {
+		return *result.SecretString, nil
+	}
+	return string(result.SecretBinary), nil
+}
+
+// getSecretFromFile returns the secret from SecretsFile.
+// The file is a YAML or JSON of maps of kinds (ssm, secretsmanager) to names to values.
+func getSecretFromFile(kind, name string) (string, error) {
+	b, err := os.ReadFile(SecretsFile)
+	if err != nil {
+		return "", err
+	}
+	var secrets map[string]map[string]any
+	if err := yaml.Unmarshal(b, &secrets); err != nil {
+		return "", fmt.Errorf("failed to parse secrets file %s: %w", SecretsFile, err)
+	}
+	v, ok := secrets[kind][name]
+	if !ok {
+		return "", fmt.Errorf("%s %s is not found in secrets file %s", kind, name, SecretsFile)
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	default:
+		// objects for secretsmanager are encoded as JSON
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
+
+// addSecretValue adds the value to redact in logs.
+func addSecretValue(v string) {
+	if len(v) < secretRedactMinLength {
+		return
+	}
+	secretValues.Store(v, struct{}{})
+	// probes are logged as JSON, so the escaped value is also redacted
+	b, _ := json.Marshal(v)
+	if escaped := string(b[1 : len(b)-1]); escaped != v {
+		secretValues.Store(escaped, struct{}{})
+	}
+}
+
+// redactSecrets replaces the secrets in s.
+func redactSecrets(s string) string {
+	secretValues.Range(func(k, _ any) bool {
+		s = strings.ReplaceAll(s, k.(string), secretRedacted)
+		return true
+	})
+	return s
+}
+
+func hasSecrets() bool {
+	var found bool
+	secretValues.Range(func(_, _ any) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// redactHandler is a slog.Handler which redacts secrets referenced by templates in logs.
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !hasSecrets() {
+		return h.Handler.Handle(ctx, r)
+	}
+	nr := slog.NewRecord(r.Time, r.Level, redactSecrets(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, nr)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redacted = append(redacted, redactAttr(a))
+	}
+	return &redactHandler{Handler: h.Handler.WithAttrs(redacted)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactSecrets(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		redacted := make([]any, 0, len(attrs))
+		for _, ga := range attrs {
+			redacted = append(redacted, redactAttr(ga))
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		s := fmt.Sprint(v.Any())
+		if r := redactSecrets(s); r != s {
+			return slog.String(a.Key, r)
+		}
+	}
+	return a
+}
@@ -0,0 +1,119 @@
+package maprobe_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestSecretFuncs(t *testing.T) {
+	maprobe.SecretsFile = "test/secrets.yaml"
+	defer func() { maprobe.SecretsFile = "" }()
+
+	pc := &maprobe.HTTPProbeConfig{
+		URL: "http://example.com/",
+		Headers: map[string]string{
+			"X-SSM":      `{{ ssm "/maprobe/api-token" }}`,
+			"X-User":     `{{ secretsmanager "maprobe/db" "username" }}`,
+			"X-Password": `{{ secretsmanager "maprobe/db" "password" }}`,
+			"X-File":     `{{ file "test/secret.txt" }}`,
+		},
+	}
+	p, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := p.(*maprobe.HTTPProbe).Headers
+	expect := map[string]string{
+		"X-SSM":      "ssm-token-value",
+		"X-User":     "maprobe",
+		"X-Password": `p@ss"word`,
+		"X-File":     "file-secret-value",
+	}
+	for name, v := range expect {
+		if headers[name] != v {
+			t.Errorf("unexpected %s: %q, want %q", name, headers[name], v)
+		}
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(maprobe.NewRedactHandler(slog.NewTextHandler(&buf, nil)))
+	logger.Info("probe ssm-token-value", "probe", p, "password", `p@ss"word`)
+	out := buf.String()
+	for _, v := range []string{"ssm-token-value", "file-secret-value", `p@ss`} {
+		if strings.Contains(out, v) {
+			t.Errorf("secret %s is not redacted: %s", v, out)
+		}
+	}
+	if !strings.Contains(out, "[REDACTED]") {
+		t.Errorf("no redacted values: %s", out)
+	}
+}
+
+func TestSecretCommandEnv(t *testing.T) {
+	maprobe.SecretsFile = "test/secrets.yaml"
+	defer func() { maprobe.SecretsFile = "" }()
+
+	command := &maprobe.CommandProbeConfig{
+		RawCommand: `printf 'test.%s.ok\t1\t1523261168\n' "$API_TOKEN"`,
+		Env:        map[string]string{"API_TOKEN": `{{ ssm "/maprobe/api-token" }}`},
+	}
+	check := &maprobe.CheckProbeConfig{
+		Name:       "secret",
+		RawCommand: `echo "$DB_USER"`,
+		Env:        map[string]string{"DB_USER": `{{ secretsmanager "maprobe/db" "username" }}`},
+	}
+	c := &maprobe.Config{Probes: []*maprobe.ProbeDefinition{{Command: command}, {Check: check}}}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	host := &maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}
+
+	p, err := command.GenerateProbe(host, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Name != "test.ssm-token-value.ok" {
+		t.Errorf("the command did not get the secret in env: %s", ms.String())
+	}
+
+	p, err = check.GenerateProbe(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if msg := p.(*maprobe.CheckProbe).CheckReport().Message; msg != "maprobe" {
+		t.Errorf("the check did not get the secret in env: %q", msg)
+	}
+}
+
+func TestSecretFuncsInvalid(t *testing.T) {
+	maprobe.SecretsFile = "test/secrets.yaml"
+	defer func() { maprobe.SecretsFile = "" }()
+
+	for _, tmpl := range []string{
+		`{{ ssm "/maprobe/not-found" }}`,
+		`{{ secretsmanager "maprobe/db" "not-found" }}`,
+		`{{ secretsmanager "maprobe/not-found" }}`,
+		`{{ file "test/not-found.txt" }}`,
+	} {
+		pc := &maprobe.HTTPProbeConfig{
+			URL:     "http://example.com/",
+			Headers: map[string]string{"X-Secret": tmpl},
+		}
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %s", tmpl)
+		}
+	}
+}
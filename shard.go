@@ -0,0 +1,62 @@
+package maprobe
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Shard represents the part of targets handled by a maprobe instance.
+// The zero value handles all targets.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// currentShard is the shard handled by this process.
+var currentShard Shard
+
+func (s Shard) validate() error {
+	if s.Count < 0 {
+		return fmt.Errorf("invalid shard count %d", s.Count)
+	}
+	if s.Index < 0 || (s.Count > 0 && s.Index >= s.Count) {
+		return fmt.Errorf("invalid shard index %d for shard count %d", s.Index, s.Count)
+	}
+	if s.Count == 0 && s.Index != 0 {
+		return fmt.Errorf("shard index %d requires shard count", s.Index)
+	}
+	return nil
+}
+
+// Enabled reports whether targets are divided into shards.
+func (s Shard) Enabled() bool {
+	return s.Count > 1
+}
+
+// Owns reports whether the target identified by key belongs to the shard.
+func (s Shard) Owns(key string) bool {
+	if !s.Enabled() {
+		return true
+	}
+	return shardOf(key, s.Count) == s.Index
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// shardOf returns the shard of the key by jump consistent hashing,
+// so only 1/n of keys move when the number of shards is changed to n.
+func shardOf(key string, count int) int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	k := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(count) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
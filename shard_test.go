@@ -0,0 +1,83 @@
+package maprobe_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fujiwara/maprobe"
+)
+
+func shardOf(t *testing.T, key string, count int) int {
+	t.Helper()
+	owner := -1
+	for i := 0; i < count; i++ {
+		if (maprobe.Shard{Index: i, Count: count}).Owns(key) {
+			if owner >= 0 {
+				t.Fatalf("%s is owned by shards %d and %d", key, owner, i)
+			}
+			owner = i
+		}
+	}
+	if owner < 0 {
+		t.Fatalf("%s is not owned by any shard", key)
+	}
+	return owner
+}
+
+func TestShard(t *testing.T) {
+	const keys = 10000
+	for _, count := range []int{2, 3, 10} {
+		dist := make([]int, count)
+		for k := 0; k < keys; k++ {
+			dist[shardOf(t, fmt.Sprintf("host-%d", k), count)]++
+		}
+		for i, n := range dist {
+			if expected := keys / count; n < expected*8/10 || n > expected*12/10 {
+				t.Errorf("unbalanced shard %d/%d: %d keys", i, count, n)
+			}
+		}
+	}
+}
+
+func TestShardResharding(t *testing.T) {
+	const keys = 10000
+	moved := 0
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprintf("host-%d", k)
+		before, after := shardOf(t, key, 4), shardOf(t, key, 5)
+		if before != after {
+			if after != 4 {
+				t.Errorf("%s moved from %d to %d, not to the new shard", key, before, after)
+			}
+			moved++
+		}
+	}
+	if moved > keys*25/100 {
+		t.Errorf("too many keys moved: %d", moved)
+	}
+}
+
+func TestShardDisabled(t *testing.T) {
+	for _, s := range []maprobe.Shard{{}, {Index: 0, Count: 1}} {
+		if s.Enabled() {
+			t.Errorf("%s must be disabled", s)
+		}
+		if !s.Owns("host-1") {
+			t.Errorf("%s must own all keys", s)
+		}
+	}
+}
+
+func TestShardInvalid(t *testing.T) {
+	flags := []maprobe.ShardFlags{
+		{ShardIndex: -1, ShardCount: 2},
+		{ShardIndex: 2, ShardCount: 2},
+		{ShardIndex: 1, ShardCount: 0},
+		{ShardIndex: 0, ShardCount: -1},
+	}
+	for _, f := range flags {
+		if _, err := f.Shard(); err == nil {
+			t.Errorf("must be failed %#v", f)
+		}
+	}
+}
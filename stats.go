@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"sync/atomic"
+	"time"
 
 	otelattribute "go.opentelemetry.io/otel/attribute"
 	otelmetric "go.opentelemetry.io/otel/metric"
@@ -19,6 +20,8 @@ type StatsCollector struct {
 	targetServicesGauge     otelmetric.Int64ObservableGauge
 	metricsCollectedCounter otelmetric.Int64Counter
 	probeExecutionsCounter  otelmetric.Int64Counter
+	cycleDurationHistogram  otelmetric.Float64Histogram
+	cycleOverrunsCounter    otelmetric.Int64Counter
 
 	// atomic values
 	currentProbeConfigs   int64
@@ -51,17 +54,28 @@ func (s *StatsCollector) RecordProbeExecution(ctx context.Context, probe Probe,
 		return
 	}
 
-	probeType := getProbeType(probe)
+	attrs := probeExecutionAttributes(probe, probeErr)
+	s.probeExecutionsCounter.Add(ctx, 1, otelmetric.WithAttributes(attrs...))
+	slog.Debug("stats: probe execution recorded", "attributes", attrs)
+}
+
+// probeExecutionAttributes returns the attributes of a probe execution.
+// The status is "success" when the probe ran without errors. For probes reporting
+// check monitoring, a failing check (e.g. CRITICAL) is also a successful execution,
+// and the result of the check is in the check_status attribute.
+func probeExecutionAttributes(probe Probe, probeErr error) []otelattribute.KeyValue {
 	status := "success"
 	if probeErr != nil {
 		status = "error"
 	}
-
-	s.probeExecutionsCounter.Add(ctx, 1,
-		otelmetric.WithAttributes(
-			otelattribute.String("status", status),
-			otelattribute.String("probe_type", probeType)))
-	slog.Debug("stats: probe execution recorded", "status", status, "probe_type", probeType)
+	attrs := []otelattribute.KeyValue{
+		otelattribute.String("status", status),
+		otelattribute.String("probe_type", getProbeType(probe)),
+	}
+	if r, ok := probe.(CheckReporter); ok && r.CheckReport() != nil {
+		attrs = append(attrs, otelattribute.String("check_status", string(r.CheckReport().Status)))
+	}
+	return attrs
 }
 
 // RecordMetricCollected records that a metric was collected
@@ -73,6 +87,28 @@ func (s *StatsCollector) RecordMetricCollected(ctx context.Context) {
 	slog.Debug("stats: metric collected")
 }
 
+// RecordCycle records a run of a probe or an aggregate definition
+func (s *StatsCollector) RecordCycle(ctx context.Context, definition string, elapsed time.Duration, overrun bool) {
+	if s == nil || s.cycleDurationHistogram == nil || s.cycleOverrunsCounter == nil {
+		return
+	}
+	attrs := otelmetric.WithAttributes(otelattribute.String("definition", definition))
+	s.cycleDurationHistogram.Record(ctx, elapsed.Seconds(), attrs)
+	if overrun {
+		s.cycleOverrunsCounter.Add(ctx, 1, attrs)
+	}
+	slog.Debug("stats: cycle recorded", "definition", definition, "elapsed", elapsed, "overrun", overrun)
+}
+
+// RecordSkippedCycle records a run skipped because the previous run is still running, as an overrun
+func (s *StatsCollector) RecordSkippedCycle(ctx context.Context, definition string) {
+	if s == nil || s.cycleOverrunsCounter == nil {
+		return
+	}
+	s.cycleOverrunsCounter.Add(ctx, 1, otelmetric.WithAttributes(otelattribute.String("definition", definition)))
+	slog.Debug("stats: skipped cycle recorded", "definition", definition)
+}
+
 // getProbeType returns the probe type string
 func getProbeType(probe Probe) string {
 	switch probe.(type) {
@@ -80,10 +116,22 @@ func getProbeType(probe Probe) string {
 		return "http"
 	case *TCPProbe:
 		return "tcp"
+	case *UDPProbe:
+		return "udp"
 	case *PingProbe:
 		return "ping"
 	case *CommandProbe:
 		return "command"
+	case *CheckProbe:
+		return "check"
+	case *DNSProbe:
+		return "dns"
+	case *TLSProbe:
+		return "tls"
+	case *TracerouteProbe:
+		return "traceroute"
+	case *HTTPScenarioProbe:
+		return "http_scenario"
 	default:
 		return "unknown"
 	}
@@ -144,6 +192,23 @@ func NewStatsCollector(provider *otelsdkmetric.MeterProvider, attrs map[string]s
 		return nil, fmt.Errorf("failed to create probe_executions counter: %w", err)
 	}
 
+	s.cycleDurationHistogram, err = s.meter.Float64Histogram(
+		"maprobe_cycle_duration_seconds",
+		otelmetric.WithDescription("Duration of runs of probe and aggregate definitions"),
+		otelmetric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cycle_duration histogram: %w", err)
+	}
+
+	s.cycleOverrunsCounter, err = s.meter.Int64Counter(
+		"maprobe_cycle_overruns_total",
+		otelmetric.WithDescription("Total number of runs of definitions which did not finish by the deadline or were skipped"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cycle_overruns counter: %w", err)
+	}
+
 	// Register observable gauge callbacks
 	_, err = s.meter.RegisterCallback(
 		func(ctx context.Context, o otelmetric.Observer) error {
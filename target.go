@@ -0,0 +1,118 @@
+package maprobe
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/goccy/go-yaml"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+// TargetsConfig represents targets of probes which are not Mackerel hosts.
+type TargetsConfig struct {
+	Hosts []*TargetHost `yaml:"hosts"`
+	File  exString      `yaml:"file"` // YAML or JSON file of a list of hosts
+
+	DNS *DNSDiscoveryConfig `yaml:"dns"`
+}
+
+// TargetHost represents a target host. It is available in templates as {{ .Host }} like Mackerel hosts.
+type TargetHost struct {
+	ID               string            `yaml:"id"` // default: name
+	Name             string            `yaml:"name"`
+	DisplayName      string            `yaml:"display_name"`
+	CustomIdentifier string            `yaml:"custom_identifier"`
+	IPAddresses      map[string]string `yaml:"ip_addresses"`
+	Meta             map[string]any    `yaml:"meta"` // available in templates as {{ .Target.Meta }}
+}
+
+// Target represents values of a target available in templates as {{ .Target }}.
+type Target struct {
+	Address string // discovered address
+	Port    int    // discovered port
+	Meta    map[string]any
+}
+
+func (th *TargetHost) validate() error {
+	if th.ID == "" {
+		th.ID = th.Name
+	}
+	if th.ID == "" {
+		return fmt.Errorf("target host must have id or name")
+	}
+	if th.Name == "" {
+		th.Name = th.ID
+	}
+	return nil
+}
+
+func (th *TargetHost) host() *mackerel.Host {
+	h := &mackerel.Host{
+		ID:               th.ID,
+		Name:             th.Name,
+		DisplayName:      th.DisplayName,
+		CustomIdentifier: th.CustomIdentifier,
+		Status:           "working",
+	}
+	for name, ip := range th.IPAddresses {
+		h.Interfaces = append(h.Interfaces, mackerel.Interface{Name: name, IPAddress: ip})
+	}
+	return h
+}
+
+func (tc *TargetsConfig) initialize() error {
+	for _, th := range tc.Hosts {
+		if err := th.validate(); err != nil {
+			return err
+		}
+	}
+	if tc.DNS != nil {
+		if err := tc.DNS.initialize(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTargetHosts loads hosts from the file.
+func loadTargetHosts(file string) ([]*TargetHost, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+	var ths []*TargetHost
+	if err := yaml.Unmarshal(b, &ths); err != nil {
+		return nil, fmt.Errorf("failed to parse targets file %s: %w", file, err)
+	}
+	for _, th := range ths {
+		if err := th.validate(); err != nil {
+			return nil, fmt.Errorf("invalid target in %s: %w", file, err)
+		}
+	}
+	return ths, nil
+}
+
+// findHosts returns the hosts of the targets.
+func (tc *TargetsConfig) findHosts(ctx context.Context) ([]*ProbeHost, error) {
+	ths := tc.Hosts
+	if file := tc.File.String(); file != "" {
+		fths, err := loadTargetHosts(file)
+		if err != nil {
+			return nil, err
+		}
+		ths = append(append([]*TargetHost{}, ths...), fths...)
+	}
+	hosts := make([]*ProbeHost, 0, len(ths))
+	for _, th := range ths {
+		hosts = append(hosts, &ProbeHost{Host: th.host(), Target: &Target{Meta: th.Meta}})
+	}
+	if tc.DNS != nil {
+		dhosts, err := tc.DNS.discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, dhosts...)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,131 @@
+package maprobe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+var (
+	DefaultDNSDiscoveryType    = "A"
+	DefaultDNSDiscoveryTimeout = 5 * time.Second
+)
+
+// DNSDiscoveryConfig represents a discovery of targets by DNS SRV or A/AAAA records.
+type DNSDiscoveryConfig struct {
+	Name    exString      `yaml:"name"`
+	Type    string        `yaml:"type"`   // SRV, A or AAAA
+	Port    int           `yaml:"port"`   // port of targets for A and AAAA
+	Server  string        `yaml:"server"` // default: system resolver
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *DNSDiscoveryConfig) initialize() error {
+	if c.Name.String() == "" {
+		return fmt.Errorf("dns discovery name is empty")
+	}
+	c.Type = strings.ToUpper(c.Type)
+	switch c.Type {
+	case "":
+		c.Type = DefaultDNSDiscoveryType
+	case "SRV", "A", "AAAA":
+	default:
+		return fmt.Errorf("invalid dns discovery type %s", c.Type)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid dns discovery port %d", c.Port)
+	}
+	if c.Type == "SRV" && c.Port != 0 {
+		return fmt.Errorf("dns discovery port is not available for SRV, because SRV records have ports")
+	}
+	if c.Server != "" {
+		if _, _, err := net.SplitHostPort(c.Server); err != nil {
+			c.Server = net.JoinHostPort(c.Server, DefaultDNSPort)
+		}
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultDNSDiscoveryTimeout
+	}
+	return nil
+}
+
+func (c *DNSDiscoveryConfig) resolver() *net.Resolver {
+	if c.Server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, c.Server)
+		},
+	}
+}
+
+// discover resolves the name and returns a target for each address.
+func (c *DNSDiscoveryConfig) discover(ctx context.Context) ([]*ProbeHost, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	r := c.resolver()
+	name := c.Name.String()
+
+	var hosts []*ProbeHost
+	add := func(hostName string, ip net.IP, port int, meta map[string]any) {
+		address := ip.String()
+		id := address
+		if port != 0 {
+			id = net.JoinHostPort(address, strconv.Itoa(port))
+		}
+		hosts = append(hosts, &ProbeHost{
+			Host: &mackerel.Host{
+				ID:         id,
+				Name:       hostName,
+				Status:     "working",
+				Interfaces: []mackerel.Interface{{Name: "dns", IPAddress: address}},
+			},
+			Target: &Target{Address: address, Port: port, Meta: meta},
+		})
+	}
+
+	switch c.Type {
+	case "SRV":
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup SRV %s: %w", name, err)
+		}
+		for _, srv := range srvs {
+			target := strings.TrimSuffix(srv.Target, ".")
+			ips, err := r.LookupIP(ctx, "ip", target)
+			if err != nil {
+				slog.Warn("failed to lookup the target of SRV", "name", name, "target", target, "error", err)
+				continue
+			}
+			for _, ip := range ips {
+				add(target, ip, int(srv.Port), map[string]any{
+					"priority": int(srv.Priority),
+					"weight":   int(srv.Weight),
+				})
+			}
+		}
+	case "A", "AAAA":
+		network := "ip4"
+		if c.Type == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup %s %s: %w", c.Type, name, err)
+		}
+		for _, ip := range ips {
+			add(name, ip, c.Port, nil)
+		}
+	}
+	slog.Debug("targets discovered by dns", "name", name, "type", c.Type, "count", len(hosts))
+	return hosts, nil
+}
@@ -0,0 +1,245 @@
+package maprobe_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fujiwara/maprobe"
+)
+
+func TestTargetsHostProbes(t *testing.T) {
+	c, _, err := maprobe.LoadConfig(context.Background(), "test/targets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := maprobe.NewClient(context.Background(), "dummy", "")
+	ms, reports := c.Probes[0].RunHostProbes(context.Background(), client, nil)
+	if len(reports) != 0 {
+		t.Errorf("unexpected reports %v", reports)
+	}
+	checks := map[string]string{
+		"router-1":             "target.tokyo",
+		"switch-1":             "target.tokyo",
+		"switch-2.example.com": "target.osaka",
+	}
+	found := map[string]bool{}
+	for _, m := range ms {
+		if !m.OtelOnly {
+			t.Errorf("metrics of targets must be otel only %v", m)
+		}
+		if name, ok := checks[m.HostID]; ok && m.Name == name {
+			found[m.HostID] = true
+		}
+	}
+	for id := range checks {
+		if !found[id] {
+			t.Errorf("metric of %s not found in %v", id, ms)
+		}
+	}
+}
+
+func TestTargetsServiceProbes(t *testing.T) {
+	c, _, err := maprobe.LoadConfig(context.Background(), "test/targets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := maprobe.NewClient(context.Background(), "dummy", "")
+	ms := c.Probes[1].RunServiceProbes(context.Background(), client, nil)
+	found := map[string]bool{}
+	for _, m := range ms {
+		if m.Service != "network" || m.OtelOnly {
+			t.Errorf("unexpected metric %v", m)
+		}
+		found[m.Name] = true
+	}
+	for _, name := range []string{"target.tokyo.switch-1", "target.osaka.switch-2_example_com"} {
+		if !found[name] {
+			t.Errorf("metric %s not found in %v", name, ms)
+		}
+	}
+}
+
+func TestTargetsTemplate(t *testing.T) {
+	c, _, err := maprobe.LoadConfig(context.Background(), "test/targets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := c.Probes[0].Targets.FindHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 3 {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	h := hosts[0]
+	if h.ID != "router-1" || h.Name != "router-1.example.com" || h.CustomIdentifier != "router-1.local" {
+		t.Errorf("unexpected host %#v", h)
+	}
+	if ip := h.IPAddresses()["eth0"]; ip != "192.0.2.1" {
+		t.Errorf("unexpected ip address %s", ip)
+	}
+	pc := &maprobe.PingProbeConfig{Address: "{{ .Host.IPAddresses.mgmt }}"}
+	p, err := pc.GenerateProbe(hosts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := p.(*maprobe.PingProbe).Address; addr != "192.0.2.12" {
+		t.Errorf("unexpected address %s", addr)
+	}
+}
+
+func TestTargetsInvalid(t *testing.T) {
+	configs := []string{
+		`
+probes:
+  - service: network
+    role: router
+    targets:
+      hosts: [{id: router-1}]
+    ping:
+      address: "{{ .Host.Name }}"
+`,
+		`
+probes:
+  - service: network
+    targets:
+      hosts: [{id: router-1}]
+    check:
+      name: check
+      command: "true"
+`,
+		`
+probes:
+  - service: network
+    targets:
+      hosts: [{custom_identifier: router-1}]
+    ping:
+      address: "{{ .Host.Name }}"
+`,
+		`
+probes:
+  - service: web
+    targets:
+      dns:
+        name: _http._tcp.example.com
+        type: srv
+        port: 80
+    ping:
+      address: "{{ .Target.Address }}"
+`,
+		`
+probes:
+  - service: web
+    targets:
+      dns:
+        name: example.com
+        type: MX
+    ping:
+      address: "{{ .Target.Address }}"
+`,
+	}
+	for _, conf := range configs {
+		f := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(f, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := maprobe.LoadConfig(context.Background(), f); err == nil {
+			t.Errorf("must be failed %s", conf)
+		}
+	}
+}
+
+// writeTestConfig writes the config to a temporary file and returns the path.
+func writeTestConfig(t *testing.T, conf string) string {
+	t.Helper()
+	f := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(f, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func loadTestConfig(t *testing.T, conf string) *maprobe.Config {
+	t.Helper()
+	c, _, err := maprobe.LoadConfig(context.Background(), writeTestConfig(t, conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestTargetsDNSDiscovery(t *testing.T) {
+	c := loadTestConfig(t, fmt.Sprintf(`
+probes:
+  - service: web
+    targets:
+      dns:
+        name: _http._tcp.example.com
+        type: srv
+        server: %[1]s
+    tcp:
+      host: "{{ .Target.Address }}"
+      port: "{{ .Target.Port }}"
+  - service: web
+    targets:
+      dns:
+        name: example.com
+        port: 80
+        server: %[1]s
+    tcp:
+      host: "{{ .Target.Address }}"
+      port: "{{ .Target.Port }}"
+`, DNSServerAddress))
+
+	tests := [][]string{
+		{"192.0.2.11:8080", "192.0.2.12:8081", "[2001:db8::12]:8081"},
+		{"192.0.2.1:80", "192.0.2.2:80"},
+	}
+	for i, expect := range tests {
+		hosts, err := c.Probes[i].Targets.FindHosts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]bool{}
+		for _, h := range hosts {
+			p, err := c.Probes[i].TCP.GenerateProbe(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tp := p.(*maprobe.TCPProbe)
+			if addr := net.JoinHostPort(tp.Host, tp.Port); addr != h.ID {
+				t.Errorf("unexpected address %s for %s", addr, h.ID)
+			}
+			found[h.ID] = true
+		}
+		for _, id := range expect {
+			if !found[id] {
+				t.Errorf("target %s not found in %v", id, found)
+			}
+		}
+		if len(found) != len(expect) {
+			t.Errorf("unexpected targets %v", found)
+		}
+	}
+}
+
+func TestTargetsDNSDiscoveryFailed(t *testing.T) {
+	c := loadTestConfig(t, fmt.Sprintf(`
+probes:
+  - service: web
+    targets:
+      dns:
+        name: notfound.example.com
+        server: %s
+    tcp:
+      host: "{{ .Target.Address }}"
+      port: "{{ .Target.Port }}"
+`, DNSServerAddress))
+	if _, err := c.Probes[0].Targets.FindHosts(); err == nil {
+		t.Error("must be failed")
+	}
+}
@@ -10,9 +10,9 @@ import (
 	"log/slog"
 	"net"
 	"regexp"
+	"strconv"
+	"sync"
 	"time"
-
-	mackerel "github.com/mackerelio/mackerel-client-go"
 )
 
 var (
@@ -21,20 +21,33 @@ var (
 	DefaultTCPMetricKeyPrefix = "tcp"
 )
 
+var tcpStepNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 type TCPProbeConfig struct {
-	Host               string        `yaml:"host"`
-	Port               string        `yaml:"port"`
-	Timeout            time.Duration `yaml:"timeout"`
-	Send               string        `yaml:"send"`
-	Quit               string        `yaml:"quiet"`
-	MaxBytes           int           `yaml:"max_bytes"`
-	ExpectPattern      string        `yaml:"expect_pattern"`
-	TLS                bool          `yaml:"tls"`
-	NoCheckCertificate bool          `yaml:"no_check_certificate"`
-	MetricKeyPrefix    string        `yaml:"metric_key_prefix"`
+	Host               string           `yaml:"host"`
+	Port               string           `yaml:"port"`
+	Timeout            time.Duration    `yaml:"timeout"`
+	Send               string           `yaml:"send"`
+	Quit               string           `yaml:"quiet"`
+	MaxBytes           int              `yaml:"max_bytes"`
+	ExpectPattern      string           `yaml:"expect_pattern"`
+	TLS                bool             `yaml:"tls"`
+	NoCheckCertificate bool             `yaml:"no_check_certificate"`
+	MetricKeyPrefix    string           `yaml:"metric_key_prefix"`
+	Steps              []*TCPStepConfig `yaml:"steps"`
+
+	TLSClientConfig `yaml:",inline"`
+}
+
+// TCPStepConfig defines a pair of send and expect in a dialogue of TCP probe.
+type TCPStepConfig struct {
+	Name          string        `yaml:"name"`
+	Send          string        `yaml:"send"`
+	ExpectPattern string        `yaml:"expect_pattern"`
+	Timeout       time.Duration `yaml:"timeout"`
 }
 
-func (pc *TCPProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
+func (pc *TCPProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
 	p := &TCPProbe{
 		hostID:             host.ID,
 		metricKeyPrefix:    pc.MetricKeyPrefix,
@@ -45,6 +58,11 @@ func (pc *TCPProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 	}
 	var err error
 
+	p.TLSClientConfig, err = pc.TLSClientConfig.expand(host)
+	if err != nil {
+		return nil, err
+	}
+
 	p.Host, err = expandPlaceHolder(pc.Host, host, nil)
 	if err != nil {
 		return nil, fmt.Errorf("invalid host: %w", err)
@@ -78,6 +96,22 @@ func (pc *TCPProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 	if p.MaxBytes == 0 {
 		p.MaxBytes = DefaultTCPMaxBytes
 	}
+
+	if len(pc.Steps) > 0 && (p.Send != "" || p.ExpectPattern != nil) {
+		return nil, fmt.Errorf("steps and send/expect_pattern are exclusive")
+	}
+	names := make(map[string]struct{}, len(pc.Steps))
+	for i, sc := range pc.Steps {
+		step, err := sc.generateStep(i, host, p.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %d: %w", i+1, err)
+		}
+		if _, found := names[step.Name]; found {
+			return nil, fmt.Errorf("duplicated step name %s", step.Name)
+		}
+		names[step.Name] = struct{}{}
+		p.Steps = append(p.Steps, step)
+	}
 	if p.metricKeyPrefix == "" {
 		p.metricKeyPrefix = DefaultTCPMetricKeyPrefix
 	}
@@ -85,6 +119,42 @@ func (pc *TCPProbeConfig) GenerateProbe(host *mackerel.Host) (Probe, error) {
 	return p, nil
 }
 
+func (sc *TCPStepConfig) generateStep(i int, host *ProbeHost, timeout time.Duration) (*tcpStep, error) {
+	step := &tcpStep{
+		Name:    sc.Name,
+		Timeout: sc.Timeout,
+	}
+	if step.Name == "" {
+		step.Name = "step" + strconv.Itoa(i+1)
+	}
+	if !tcpStepNameRegexp.MatchString(step.Name) {
+		return nil, fmt.Errorf("invalid name %s", step.Name)
+	}
+
+	var err error
+	step.Send, err = expandPlaceHolder(sc.Send, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid send: %w", err)
+	}
+	pattern, err := expandPlaceHolder(sc.ExpectPattern, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+	}
+	if pattern != "" {
+		step.ExpectPattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+		}
+	}
+	if step.Send == "" && step.ExpectPattern == nil {
+		return nil, fmt.Errorf("send or expect_pattern is required")
+	}
+	if step.Timeout == 0 {
+		step.Timeout = timeout
+	}
+	return step, nil
+}
+
 type TCPProbe struct {
 	hostID          string
 	metricKeyPrefix string
@@ -98,6 +168,15 @@ type TCPProbe struct {
 	Timeout            time.Duration
 	TLS                bool
 	NoCheckCertificate bool
+	Steps              []*tcpStep
+	TLSClientConfig
+}
+
+type tcpStep struct {
+	Name          string
+	Send          string
+	ExpectPattern *regexp.Regexp
+	Timeout       time.Duration
 }
 
 func (p *TCPProbe) HostID() string {
@@ -133,13 +212,38 @@ func (p *TCPProbe) Run(ctx context.Context) (ms Metrics, err error) {
 
 	addr := net.JoinHostPort(p.Host, p.Port)
 
+	var tlsConfig *tls.Config
+	if p.TLS {
+		tlsConfig, err = p.TLSClientConfig.newTLSConfig(p.NoCheckCertificate)
+		if err != nil {
+			return ms, err
+		}
+	}
+
 	slog.Debug("dialing", "addr", addr)
-	conn, err := dialTCP(timeoutCtx, addr, p.TLS, p.NoCheckCertificate, p.Timeout)
+	conn, err := dialTCP(timeoutCtx, addr, tlsConfig, p.Timeout)
 	if err != nil {
 		return ms, fmt.Errorf("connect failed: %w", err)
 	}
 	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(p.Timeout))
+	// timeout bounds the whole dialogue, and the run is also bounded by ctx
+	deadline, _ := timeoutCtx.Deadline()
+	conn.SetDeadline(deadline)
+	// the deadline set at the cancel of ctx is not replaced by deadlines of steps
+	var mu sync.Mutex
+	stop := context.AfterFunc(timeoutCtx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+	setStepDeadline := func(d time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		if timeoutCtx.Err() == nil {
+			conn.SetDeadline(d)
+		}
+	}
 
 	slog.Debug("connected", "addr", addr)
 
@@ -156,7 +260,22 @@ func (p *TCPProbe) Run(ctx context.Context) (ms Metrics, err error) {
 		}
 	}
 
-	if p.Send != "" {
+	if len(p.Steps) > 0 {
+		// data received before send of a step is discarded,
+		// data received after the match is passed to the next step.
+		var buf []byte
+		for _, step := range p.Steps {
+			if err := timeoutCtx.Err(); err != nil {
+				return ms, fmt.Errorf("step %s not started: %w", step.Name, err)
+			}
+			var stepMetrics Metrics
+			stepMetrics, buf, err = p.runStep(conn, step, buf, deadline, setStepDeadline)
+			ms = append(ms, stepMetrics...)
+			if err != nil {
+				return ms, fmt.Errorf("step %s failed: %w", step.Name, err)
+			}
+		}
+	} else if p.Send != "" {
 		slog.Debug("send", "data", p.Send)
 		_, err := io.WriteString(conn, p.Send)
 		if err != nil {
@@ -185,14 +304,67 @@ func (p *TCPProbe) Run(ctx context.Context) (ms Metrics, err error) {
 	return
 }
 
-func dialTCP(ctx context.Context, address string, useTLS bool, noCheckCertificate bool, timeout time.Duration) (net.Conn, error) {
+// runStep sends data of the step and reads until the expect pattern matches,
+// the deadline of the step is exceeded or the read bytes exceed MaxBytes.
+// The deadline of the step does not exceed the deadline of the probe, and is set by setDeadline.
+func (p *TCPProbe) runStep(conn net.Conn, step *tcpStep, buf []byte, deadline time.Time, setDeadline func(time.Time)) (ms Metrics, rest []byte, err error) {
+	var ok bool
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, step.Name+".elapsed.seconds", elapsed.Seconds()))
+		if ok {
+			ms = append(ms, newMetric(p, step.Name+".check.ok", 1))
+		} else {
+			ms = append(ms, newMetric(p, step.Name+".check.ok", 0))
+		}
+	}()
+	if d := start.Add(step.Timeout); d.Before(deadline) {
+		deadline = d
+	}
+	setDeadline(deadline)
+
+	if step.Send != "" {
+		slog.Debug("send", "step", step.Name, "data", step.Send)
+		if _, err := io.WriteString(conn, step.Send); err != nil {
+			return ms, nil, fmt.Errorf("send failed: %w", err)
+		}
+		buf = nil
+	}
+	if step.ExpectPattern == nil {
+		ok = true
+		return ms, buf, nil
+	}
+
+	chunk := make([]byte, 4096)
+	for {
+		if loc := step.ExpectPattern.FindIndex(buf); loc != nil {
+			slog.Debug("read", "step", step.Name, "data", string(buf))
+			ok = true
+			return ms, buf[loc[1]:], nil
+		}
+		if len(buf) >= p.MaxBytes {
+			return ms, nil, fmt.Errorf("unexpected response")
+		}
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if err != nil {
+			if step.ExpectPattern.Match(buf) {
+				continue
+			}
+			slog.Debug("read", "step", step.Name, "data", string(buf))
+			return ms, nil, fmt.Errorf("read failed: %w", err)
+		}
+	}
+}
+
+// dialTCP dials to the address. When tlsConfig is not nil, it uses TLS.
+func dialTCP(ctx context.Context, address string, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
 	d := &net.Dialer{Timeout: timeout}
-	if useTLS {
+	if tlsConfig != nil {
 		td := &tls.Dialer{
 			NetDialer: d,
-			Config: &tls.Config{
-				InsecureSkipVerify: noCheckCertificate,
-			},
+			Config:    tlsConfig,
 		}
 		return td.DialContext(ctx, "tcp", address)
 	}
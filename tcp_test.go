@@ -99,7 +99,7 @@ func TestTCP(t *testing.T) {
 		ExpectPattern: "^hello",
 	}
 
-	probe, err := pc.GenerateProbe(&mackerel.Host{ID: "test", Name: host})
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: host}})
 	if err != nil {
 		t.Error(err)
 	}
@@ -135,7 +135,7 @@ func TestTCPFail(t *testing.T) {
 		ExpectPattern: "^world",
 	}
 
-	probe, err := pc.GenerateProbe(&mackerel.Host{ID: "test", Name: host})
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: host}})
 	if err != nil {
 		t.Error(err)
 	}
@@ -174,7 +174,7 @@ func TestTCPTLS(t *testing.T) {
 		NoCheckCertificate: true, // Accept self-signed certificate
 	}
 
-	probe, err := pc.GenerateProbe(&mackerel.Host{ID: "test", Name: host})
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: host}})
 	if err != nil {
 		t.Error(err)
 	}
@@ -213,3 +213,194 @@ func TestTCPTLS(t *testing.T) {
 	}
 	t.Log(ms.String())
 }
+
+// testTCPDialogueServer sends a banner in multiple packets and replies to AUTH and stats commands.
+func testTCPDialogueServer(t *testing.T) (string, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				io.WriteString(conn, "220 maprobe")
+				time.Sleep(50 * time.Millisecond)
+				io.WriteString(conn, " ready\r\n")
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					switch scanner.Text() {
+					case "AUTH secret":
+						io.WriteString(conn, "+OK\r\n")
+					case "stats":
+						io.WriteString(conn, "STAT pid 1\r\n")
+						time.Sleep(50 * time.Millisecond)
+						io.WriteString(conn, "STAT uptime 10\r\nEND\r\n")
+					default:
+						io.WriteString(conn, "-ERR\r\n")
+					}
+				}
+			}(conn)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return host, port
+}
+
+func TestTCPSteps(t *testing.T) {
+	host, port := testTCPDialogueServer(t)
+
+	tests := []struct {
+		name        string
+		steps       []*maprobe.TCPStepConfig
+		expectError bool
+		checks      map[string]float64
+	}{
+		{
+			name: "success",
+			steps: []*maprobe.TCPStepConfig{
+				{Name: "banner", ExpectPattern: `^220 .* ready\r\n`},
+				{Name: "auth", Send: "AUTH {{ .Host.Name }}\r\n", ExpectPattern: `^\+OK`},
+				{Send: "stats\r\n", ExpectPattern: `(?m)^END\r$`},
+			},
+			checks: map[string]float64{
+				"tcp.banner.check.ok": 1,
+				"tcp.auth.check.ok":   1,
+				"tcp.step3.check.ok":  1,
+				"tcp.check.ok":        1,
+			},
+		},
+		{
+			name: "timeout",
+			steps: []*maprobe.TCPStepConfig{
+				{Name: "banner", ExpectPattern: `^220 `},
+				{Name: "auth", Send: "AUTH wrong\r\n", ExpectPattern: `^\+OK`, Timeout: 300 * time.Millisecond},
+				{Name: "stats", Send: "stats\r\n", ExpectPattern: `END`},
+			},
+			expectError: true,
+			checks: map[string]float64{
+				"tcp.banner.check.ok": 1,
+				"tcp.auth.check.ok":   0,
+				"tcp.check.ok":        0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := &maprobe.TCPProbeConfig{
+				Host:  host,
+				Port:  port,
+				Steps: tt.steps,
+			}
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: "secret"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			found := map[string]bool{}
+			for _, m := range ms {
+				if v, ok := tt.checks[m.Name]; ok {
+					found[m.Name] = true
+					if m.Value != v {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, v)
+					}
+				}
+				if m.Name == "tcp.stats.check.ok" {
+					t.Error("step after the failed step must not be run")
+				}
+			}
+			for name := range tt.checks {
+				if !found[name] {
+					t.Errorf("metric %s not found", name)
+				}
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestTCPStepsDeadline(t *testing.T) {
+	host, port := testTCPDialogueServer(t)
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+	}{
+		{
+			name:    "probe timeout",
+			timeout: 300 * time.Millisecond,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+		},
+		{
+			name: "context deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 300*time.Millisecond)
+			},
+		},
+		{
+			name: "context canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(300*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := &maprobe.TCPProbeConfig{
+				Host:    host,
+				Port:    port,
+				Timeout: tt.timeout,
+				Steps: []*maprobe.TCPStepConfig{
+					{Name: "banner", ExpectPattern: `^220 `},
+					{Name: "never", ExpectPattern: `never`, Timeout: 5 * time.Second},
+				},
+			}
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: "secret"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			if _, err := probe.Run(ctx); err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("the step must not exceed the deadline of the probe: elapsed %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestTCPStepsInvalid(t *testing.T) {
+	configs := []*maprobe.TCPProbeConfig{
+		{Host: "localhost", Port: "25", Send: "HELO\r\n", Steps: []*maprobe.TCPStepConfig{{ExpectPattern: "^220"}}},
+		{Host: "localhost", Port: "25", Steps: []*maprobe.TCPStepConfig{{Name: "a"}}},
+		{Host: "localhost", Port: "25", Steps: []*maprobe.TCPStepConfig{{Name: "a b", ExpectPattern: "^220"}}},
+		{Host: "localhost", Port: "25", Steps: []*maprobe.TCPStepConfig{{Name: "a", ExpectPattern: "^220"}, {Name: "a", Send: "QUIT\r\n"}}},
+		{Host: "localhost", Port: "25", Steps: []*maprobe.TCPStepConfig{{ExpectPattern: "("}}},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package maprobe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultTLSTimeout         = 5 * time.Second
+	DefaultTLSMetricKeyPrefix = "tls"
+)
+
+// startTLSFuncs negotiates STARTTLS on a plain connection for each protocol.
+var startTLSFuncs = map[string]func(conn net.Conn) error{
+	"smtp":     startTLSSMTP,
+	"imap":     startTLSIMAP,
+	"postgres": startTLSPostgres,
+}
+
+type TLSProbeConfig struct {
+	Host            string        `yaml:"host"`
+	Port            string        `yaml:"port"`
+	StartTLS        string        `yaml:"starttls"`
+	Timeout         time.Duration `yaml:"timeout"`
+	MetricKeyPrefix string        `yaml:"metric_key_prefix"`
+
+	TLSClientConfig `yaml:",inline"`
+}
+
+func (pc *TLSProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
+	p := &TLSProbe{
+		hostID:          host.ID,
+		metricKeyPrefix: pc.MetricKeyPrefix,
+		StartTLS:        strings.ToLower(pc.StartTLS),
+		Timeout:         pc.Timeout,
+	}
+	var err error
+
+	p.TLSClientConfig, err = pc.TLSClientConfig.expand(host)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Host, err = expandPlaceHolder(pc.Host, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host: %w", err)
+	}
+	if p.Host == "" {
+		return nil, fmt.Errorf("no host")
+	}
+
+	p.Port, err = expandPlaceHolder(pc.Port, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %w", err)
+	}
+	if p.Port == "" {
+		return nil, fmt.Errorf("no port")
+	}
+
+	if p.StartTLS != "" {
+		if _, found := startTLSFuncs[p.StartTLS]; !found {
+			return nil, fmt.Errorf("invalid starttls %s", pc.StartTLS)
+		}
+	}
+
+	if p.ServerName == "" {
+		p.ServerName = p.Host
+	}
+	if p.Timeout == 0 {
+		p.Timeout = DefaultTLSTimeout
+	}
+	if p.metricKeyPrefix == "" {
+		p.metricKeyPrefix = DefaultTLSMetricKeyPrefix
+	}
+	return p, nil
+}
+
+type TLSProbe struct {
+	hostID          string
+	metricKeyPrefix string
+
+	Host     string
+	Port     string
+	StartTLS string
+	Timeout  time.Duration
+	TLSClientConfig
+}
+
+func (p *TLSProbe) HostID() string {
+	return p.hostID
+}
+
+func (p *TLSProbe) MetricName(name string) string {
+	return p.metricKeyPrefix + "." + name
+}
+
+func (p *TLSProbe) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+func (p *TLSProbe) Run(ctx context.Context) (ms Metrics, err error) {
+	var ok bool
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, "elapsed.seconds", elapsed.Seconds()))
+		if ok {
+			ms = append(ms, newMetric(p, "check.ok", 1))
+		} else {
+			ms = append(ms, newMetric(p, "check.ok", 0))
+		}
+		slog.Debug("tls probe completed", "metrics", ms.String())
+	}()
+
+	// The certificates are verified after the handshake to report
+	// the metrics of them even if they are invalid.
+	tlsConfig, err := p.TLSClientConfig.newTLSConfig(true)
+	if err != nil {
+		return ms, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(p.Host, p.Port)
+	slog.Debug("dialing", "addr", addr, "starttls", p.StartTLS)
+	conn, err := dialTCP(timeoutCtx, addr, nil, p.Timeout)
+	if err != nil {
+		return ms, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.Timeout))
+
+	if p.StartTLS != "" {
+		if err := startTLSFuncs[p.StartTLS](conn); err != nil {
+			return ms, fmt.Errorf("starttls %s failed: %w", p.StartTLS, err)
+		}
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(timeoutCtx); err != nil {
+		return ms, fmt.Errorf("handshake failed: %w", err)
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return ms, fmt.Errorf("no peer certificates")
+	}
+
+	ms = append(ms, newMetric(p, "version", tlsVersionNumber(state.Version)))
+	if len(state.OCSPResponse) > 0 {
+		ms = append(ms, newMetric(p, "ocsp.stapled", 1))
+	} else {
+		ms = append(ms, newMetric(p, "ocsp.stapled", 0))
+	}
+
+	now := time.Now()
+	leaf := state.PeerCertificates[0]
+	ms = append(ms, newMetric(p, "certificate.expires_in_days", leaf.NotAfter.Sub(now).Hours()/24))
+	ms = append(ms, newMetric(p, "chain.length", float64(len(state.PeerCertificates))))
+
+	intermediates := x509.NewCertPool()
+	var earliest *x509.Certificate
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+		if isSelfSigned(cert) {
+			// a root certificate sent by the server is not an intermediate
+			continue
+		}
+		if earliest == nil || cert.NotAfter.Before(earliest.NotAfter) {
+			earliest = cert
+		}
+	}
+	if earliest != nil {
+		ms = append(ms, newMetric(p, "intermediate.expires_in_days", earliest.NotAfter.Sub(now).Hours()/24))
+		slog.Debug("earliest-expiring intermediate", "subject", earliest.Subject.String(), "expires_at", earliest.NotAfter)
+	}
+
+	_, chainErr := leaf.Verify(x509.VerifyOptions{
+		Roots:         tlsConfig.RootCAs,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	if chainErr != nil {
+		ms = append(ms, newMetric(p, "chain.valid", 0))
+	} else {
+		ms = append(ms, newMetric(p, "chain.valid", 1))
+	}
+	hostErr := leaf.VerifyHostname(p.ServerName)
+	if hostErr != nil {
+		ms = append(ms, newMetric(p, "hostname.match", 0))
+	} else {
+		ms = append(ms, newMetric(p, "hostname.match", 1))
+	}
+
+	if chainErr != nil {
+		return ms, fmt.Errorf("invalid certificate chain: %w", chainErr)
+	}
+	if hostErr != nil {
+		return ms, fmt.Errorf("hostname mismatch: %w", hostErr)
+	}
+	ok = true
+	return
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// tlsVersionNumber returns the TLS version as a number (e.g. 1.3). Unknown versions are 0.
+func tlsVersionNumber(v uint16) float64 {
+	switch v {
+	case tls.VersionTLS10:
+		return 1.0
+	case tls.VersionTLS11:
+		return 1.1
+	case tls.VersionTLS12:
+		return 1.2
+	case tls.VersionTLS13:
+		return 1.3
+	default:
+		return 0
+	}
+}
+
+// readSMTPResponse reads a (multi-line) SMTP response and returns its status code.
+func readSMTPResponse(r *bufio.Reader) (string, error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if len(line) < 4 {
+			return "", fmt.Errorf("invalid response %q", line)
+		}
+		if line[3] != '-' {
+			return line[:3], nil
+		}
+	}
+}
+
+func startTLSSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if code, err := readSMTPResponse(r); err != nil {
+		return err
+	} else if code != "220" {
+		return fmt.Errorf("unexpected greeting %s", code)
+	}
+	if _, err := io.WriteString(conn, "EHLO maprobe\r\n"); err != nil {
+		return err
+	}
+	if code, err := readSMTPResponse(r); err != nil {
+		return err
+	} else if code != "250" {
+		return fmt.Errorf("unexpected EHLO response %s", code)
+	}
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	if code, err := readSMTPResponse(r); err != nil {
+		return err
+	} else if code != "220" {
+		return fmt.Errorf("unexpected STARTTLS response %s", code)
+	}
+	return nil
+}
+
+func startTLSIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "* OK") {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	if _, err := io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a001 ") {
+			if !strings.HasPrefix(line, "a001 OK") {
+				return fmt.Errorf("unexpected STARTTLS response %q", strings.TrimSpace(line))
+			}
+			return nil
+		}
+	}
+}
+
+// postgresSSLRequestCode is the request code of SSLRequest message of PostgreSQL protocol.
+const postgresSSLRequestCode = 80877103
+
+func startTLSPostgres(conn net.Conn) error {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	res := make([]byte, 1)
+	if _, err := io.ReadFull(conn, res); err != nil {
+		return err
+	}
+	if res[0] != 'S' {
+		return fmt.Errorf("server does not support SSL")
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package maprobe_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+// testSTARTTLSServer serves TLS after the STARTTLS negotiation of the protocol.
+func testSTARTTLSServer(t *testing.T, cert tls.Certificate, starttls string) (string, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				switch starttls {
+				case "smtp":
+					io.WriteString(conn, "220 maprobe.test ESMTP\r\n")
+					r.ReadString('\n') // EHLO
+					io.WriteString(conn, "250-maprobe.test\r\n250 STARTTLS\r\n")
+					r.ReadString('\n') // STARTTLS
+					io.WriteString(conn, "220 Ready to start TLS\r\n")
+				case "imap":
+					io.WriteString(conn, "* OK IMAP4rev1 ready\r\n")
+					line, _ := r.ReadString('\n')
+					tag, _, _ := strings.Cut(line, " ")
+					io.WriteString(conn, tag+" OK Begin TLS negotiation now\r\n")
+				case "postgres":
+					io.ReadFull(r, make([]byte, 8))
+					conn.Write([]byte("S"))
+				}
+				tlsConn := tls.Server(conn, config)
+				tlsConn.Handshake()
+			}(conn)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return host, port
+}
+
+func TestTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	caFile, cert := pki.CAFile, pki.ChainCert
+
+	tests := []struct {
+		name        string
+		starttls    string
+		config      maprobe.TLSClientConfig
+		expectError bool
+		checks      map[string]float64
+	}{
+		{
+			name:   "valid",
+			config: maprobe.TLSClientConfig{CAFile: caFile, ServerName: "maprobe.test"},
+			checks: map[string]float64{
+				"tls.check.ok":       1,
+				"tls.chain.valid":    1,
+				"tls.chain.length":   2,
+				"tls.hostname.match": 1,
+				"tls.ocsp.stapled":   1,
+				"tls.version":        1.3,
+			},
+		},
+		{
+			name:        "hostname mismatch",
+			config:      maprobe.TLSClientConfig{CAFile: caFile, ServerName: "other.test"},
+			expectError: true,
+			checks: map[string]float64{
+				"tls.check.ok":       0,
+				"tls.chain.valid":    1,
+				"tls.hostname.match": 0,
+			},
+		},
+		{
+			name:        "unknown authority",
+			config:      maprobe.TLSClientConfig{ServerName: "maprobe.test"},
+			expectError: true,
+			checks: map[string]float64{
+				"tls.check.ok":       0,
+				"tls.chain.valid":    0,
+				"tls.hostname.match": 1,
+			},
+		},
+		{
+			name:     "smtp",
+			starttls: "smtp",
+			config:   maprobe.TLSClientConfig{CAFile: caFile, ServerName: "maprobe.test"},
+			checks:   map[string]float64{"tls.check.ok": 1},
+		},
+		{
+			name:     "imap",
+			starttls: "imap",
+			config:   maprobe.TLSClientConfig{CAFile: caFile, ServerName: "maprobe.test"},
+			checks:   map[string]float64{"tls.check.ok": 1},
+		},
+		{
+			name:     "postgres",
+			starttls: "postgres",
+			config:   maprobe.TLSClientConfig{CAFile: caFile, ServerName: "maprobe.test"},
+			checks:   map[string]float64{"tls.check.ok": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port := testSTARTTLSServer(t, cert, tt.starttls)
+			pc := &maprobe.TLSProbeConfig{
+				Host:            host,
+				Port:            port,
+				StartTLS:        tt.starttls,
+				TLSClientConfig: tt.config,
+			}
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			found := map[string]bool{}
+			for _, m := range ms {
+				if v, ok := tt.checks[m.Name]; ok {
+					found[m.Name] = true
+					if m.Value != v {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, v)
+					}
+				}
+				switch m.Name {
+				case "tls.certificate.expires_in_days":
+					if m.Value < 29 || 30 < m.Value {
+						t.Errorf("unexpected %s %f", m.Name, m.Value)
+					}
+				case "tls.intermediate.expires_in_days":
+					found[m.Name] = true
+					if m.Value < 9 || 10 < m.Value {
+						t.Errorf("unexpected %s %f", m.Name, m.Value)
+					}
+				}
+			}
+			for name := range tt.checks {
+				if !found[name] {
+					t.Errorf("metric %s not found", name)
+				}
+			}
+			if !found["tls.intermediate.expires_in_days"] {
+				t.Error("metric tls.intermediate.expires_in_days not found")
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestTLSInvalid(t *testing.T) {
+	configs := []*maprobe.TLSProbeConfig{
+		{Port: "443"},
+		{Host: "example.com"},
+		{Host: "example.com", Port: "25", StartTLS: "pop3"},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package maprobe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSClientConfig represents TLS options shared by TLS-capable probes.
+type TLSClientConfig struct {
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+	CAFile     string `yaml:"ca_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+// expand returns a copy of TLSClientConfig which placeholders are expanded.
+func (c TLSClientConfig) expand(host *ProbeHost) (TLSClientConfig, error) {
+	var ex TLSClientConfig
+	var err error
+	if ex.ClientCert, err = expandPlaceHolder(c.ClientCert, host, nil); err != nil {
+		return ex, fmt.Errorf("invalid client_cert: %w", err)
+	}
+	if ex.ClientKey, err = expandPlaceHolder(c.ClientKey, host, nil); err != nil {
+		return ex, fmt.Errorf("invalid client_key: %w", err)
+	}
+	if ex.CAFile, err = expandPlaceHolder(c.CAFile, host, nil); err != nil {
+		return ex, fmt.Errorf("invalid ca_file: %w", err)
+	}
+	if ex.ServerName, err = expandPlaceHolder(c.ServerName, host, nil); err != nil {
+		return ex, fmt.Errorf("invalid server_name: %w", err)
+	}
+	if (ex.ClientCert == "") != (ex.ClientKey == "") {
+		return ex, fmt.Errorf("both client_cert and client_key are required")
+	}
+	return ex, nil
+}
+
+// newTLSConfig creates a tls.Config. Files are loaded for each call to follow their rotation.
+func (c TLSClientConfig) newTLSConfig(noCheckCertificate bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: noCheckCertificate,
+		ServerName:         c.ServerName,
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		b, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
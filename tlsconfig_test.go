@@ -0,0 +1,270 @@
+package maprobe_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testPKI struct {
+	CAFile     string
+	ClientCert string
+	ClientKey  string
+	ServerTLS  *tls.Config
+
+	// ChainCert is a certificate for "maprobe.test" (30 days) issued by
+	// an intermediate CA (10 days) of the CA, including the intermediate.
+	ChainCert tls.Certificate
+}
+
+// newTestPKI creates a CA, a server certificate for "maprobe.test" and a client certificate.
+// The server requires the client certificate signed by the CA.
+// It also creates a chain of an intermediate CA and a server certificate.
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	now := time.Now()
+
+	issue := func(tmpl, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		return cert, key
+	}
+	caTmpl := func(serial int64, cn string, days int) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(time.Duration(days) * 24 * time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+	}
+	leafTmpl := func(serial int64, cn string, usage x509.ExtKeyUsage, days int) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(time.Duration(days) * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			DNSNames:     []string{cn},
+		}
+	}
+	writePEM := func(name, typ string, b []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	caCert, caKey := issue(caTmpl(1, "maprobe test CA", 365), nil, nil)
+	serverCert, serverKey := issue(leafTmpl(2, "maprobe.test", x509.ExtKeyUsageServerAuth, 1), caCert, caKey)
+	clientCert, clientKey := issue(leafTmpl(3, "maprobe-client", x509.ExtKeyUsageClientAuth, 1), caCert, caKey)
+	interCert, interKey := issue(caTmpl(4, "maprobe test intermediate CA", 10), caCert, caKey)
+	chainCert, chainKey := issue(leafTmpl(5, "maprobe.test", x509.ExtKeyUsageServerAuth, 30), interCert, interKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return &testPKI{
+		CAFile:     writePEM("ca.pem", "CERTIFICATE", caCert.Raw),
+		ClientCert: writePEM("client.pem", "CERTIFICATE", clientCert.Raw),
+		ClientKey:  writePEM("client-key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(clientKey)),
+		ServerTLS: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		},
+		ChainCert: tls.Certificate{
+			Certificate: [][]byte{chainCert.Raw, interCert.Raw},
+			PrivateKey:  chainKey,
+			OCSPStaple:  []byte("dummy"),
+		},
+	}
+}
+
+func (pki *testPKI) configs() map[string]maprobe.TLSClientConfig {
+	return map[string]maprobe.TLSClientConfig{
+		"mtls": {
+			ClientCert: pki.ClientCert,
+			ClientKey:  pki.ClientKey,
+			CAFile:     pki.CAFile,
+			ServerName: "maprobe.test",
+		},
+		"no client cert": {
+			CAFile:     pki.CAFile,
+			ServerName: "maprobe.test",
+		},
+		"server name mismatch": {
+			ClientCert: pki.ClientCert,
+			ClientKey:  pki.ClientKey,
+			CAFile:     pki.CAFile,
+			ServerName: "other.test",
+		},
+	}
+}
+
+func checkMTLSResult(t *testing.T, name string, ms maprobe.Metrics, err error, okMetric string) {
+	t.Helper()
+	if name == "mtls" && err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if name != "mtls" && err == nil {
+		t.Error("expected error, but got nil")
+	}
+	for _, m := range ms {
+		if m.Name == okMetric {
+			if name == "mtls" && m.Value != 1 || name != "mtls" && m.Value != 0 {
+				t.Errorf("unexpected %s %f", okMetric, m.Value)
+			}
+		}
+	}
+}
+
+func TestHTTPMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Hello %s", r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	ts.TLS = pki.ServerTLS
+	ts.StartTLS()
+	defer ts.Close()
+
+	for name, tc := range pki.configs() {
+		t.Run(name, func(t *testing.T) {
+			pc := &maprobe.HTTPProbeConfig{
+				URL:             ts.URL,
+				ExpectPattern:   "^Hello maprobe-client$",
+				TLSClientConfig: tc,
+			}
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			checkMTLSResult(t, name, ms, err, "http.check.ok")
+		})
+	}
+}
+
+func TestTCPMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", pki.ServerTLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte("HELLO\n"))
+			}(conn)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+
+	for name, tc := range pki.configs() {
+		t.Run(name, func(t *testing.T) {
+			pc := &maprobe.TCPProbeConfig{
+				Host:            host,
+				Port:            port,
+				TLS:             true,
+				ExpectPattern:   "^HELLO",
+				TLSClientConfig: tc,
+			}
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			checkMTLSResult(t, name, ms, err, "tcp.check.ok")
+		})
+	}
+}
+
+func TestGRPCMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(pki.ServerTLS)))
+	healthpb.RegisterHealthServer(s, setupHealthServer())
+	go s.Serve(l)
+	defer s.Stop()
+
+	for name, tc := range pki.configs() {
+		t.Run(name, func(t *testing.T) {
+			pc := &maprobe.GRPCProbeConfig{
+				Address:         l.Addr().String(),
+				TLS:             true,
+				Timeout:         3 * time.Second,
+				TLSClientConfig: tc,
+			}
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			checkMTLSResult(t, name, ms, err, "grpc.check.ok")
+		})
+	}
+}
+
+func TestTLSClientConfigInvalid(t *testing.T) {
+	pc := &maprobe.HTTPProbeConfig{
+		URL:             "https://example.com",
+		TLSClientConfig: maprobe.TLSClientConfig{ClientCert: "client.pem"},
+	}
+	if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+		t.Error("client_cert without client_key must be failed")
+	}
+
+	pc = &maprobe.HTTPProbeConfig{
+		URL:             "https://example.com",
+		TLSClientConfig: maprobe.TLSClientConfig{CAFile: "/path/to/not/exists.pem"},
+	}
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := probe.Run(context.Background()); err == nil {
+		t.Error("CA file not found must be failed")
+	}
+}
@@ -0,0 +1,447 @@
+package maprobe
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+var (
+	DefaultTracerouteTimeout         = time.Second
+	DefaultTracerouteCount           = 3
+	DefaultTracerouteMaxHops         = 30
+	DefaultTracerouteMetricKeyPrefix = "traceroute"
+)
+
+var (
+	// TraceroutePathTTL is the duration to keep the last path of a probe which does not run anymore.
+	TraceroutePathTTL = 10 * time.Minute
+
+	// traceroutePaths holds the last path of each probe to detect path changes across cycles.
+	traceroutePaths       = sync.Map{} // key -> *traceroutePath
+	traceroutePathsPurged atomic.Int64 // unix time of the last purge
+	tracerouteEchoID      atomic.Uint32
+)
+
+type traceroutePath struct {
+	hops    []string
+	updated time.Time
+}
+
+// swapTraceroutePath stores the path of the key and returns the previous one.
+// Paths not updated for TraceroutePathTTL are purged, because targets (e.g. discovered by DNS) come and go.
+func swapTraceroutePath(key string, hops []string) ([]string, bool) {
+	now := time.Now()
+	prev, found := traceroutePaths.Swap(key, &traceroutePath{hops: hops, updated: now})
+
+	last := traceroutePathsPurged.Load()
+	if now.Unix()-last >= int64(time.Minute/time.Second) && traceroutePathsPurged.CompareAndSwap(last, now.Unix()) {
+		traceroutePaths.Range(func(k, v any) bool {
+			if now.Sub(v.(*traceroutePath).updated) > TraceroutePathTTL {
+				traceroutePaths.Delete(k)
+			}
+			return true
+		})
+	}
+
+	if !found {
+		return nil, false
+	}
+	return prev.(*traceroutePath).hops, true
+}
+
+type TracerouteProbeConfig struct {
+	Address         string        `yaml:"address"`
+	MaxHops         int           `yaml:"max_hops"`
+	Count           int           `yaml:"count"`
+	Timeout         time.Duration `yaml:"timeout"`
+	IPVersion       int           `yaml:"ip_version"`
+	MetricKeyPrefix string        `yaml:"metric_key_prefix"`
+}
+
+func (pc *TracerouteProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
+	p := &TracerouteProbe{
+		hostID:          host.ID,
+		metricKeyPrefix: pc.MetricKeyPrefix,
+		MaxHops:         pc.MaxHops,
+		Count:           pc.Count,
+		Timeout:         pc.Timeout,
+		IPVersion:       pc.IPVersion,
+	}
+	var err error
+
+	p.Address, err = expandPlaceHolder(pc.Address, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+	if p.Address == "" {
+		return nil, fmt.Errorf("no address")
+	}
+
+	switch p.IPVersion {
+	case 0, 4, 6:
+	default:
+		return nil, fmt.Errorf("invalid ip_version %d (4 or 6)", p.IPVersion)
+	}
+	// the round and the TTL are encoded into the sequence number of an echo request
+	if p.MaxHops < 0 || 255 < p.MaxHops {
+		return nil, fmt.Errorf("invalid max_hops %d (1-255)", p.MaxHops)
+	}
+	if p.Count < 0 || 255 < p.Count {
+		return nil, fmt.Errorf("invalid count %d (1-255)", p.Count)
+	}
+
+	if p.MaxHops == 0 {
+		p.MaxHops = DefaultTracerouteMaxHops
+	}
+	if p.Count == 0 {
+		p.Count = DefaultTracerouteCount
+	}
+	if p.Timeout == 0 {
+		p.Timeout = DefaultTracerouteTimeout
+	}
+	if p.metricKeyPrefix == "" {
+		p.metricKeyPrefix = DefaultTracerouteMetricKeyPrefix
+	}
+	return p, nil
+}
+
+type TracerouteProbe struct {
+	hostID          string
+	metricKeyPrefix string
+
+	Address   string
+	MaxHops   int
+	Count     int
+	Timeout   time.Duration
+	IPVersion int
+}
+
+func (p *TracerouteProbe) HostID() string {
+	return p.hostID
+}
+
+func (p *TracerouteProbe) MetricName(name string) string {
+	return p.metricKeyPrefix + "." + name
+}
+
+func (p *TracerouteProbe) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+type tracerouteHop struct {
+	TTL      int
+	Address  string
+	Sent     int
+	Received int
+	RTTs     []time.Duration
+}
+
+func (h *tracerouteHop) lossPercentage() float64 {
+	if h.Sent == 0 {
+		return 0
+	}
+	return float64(h.Sent-h.Received) / float64(h.Sent) * 100
+}
+
+func (h *tracerouteHop) rtt() (min, avg, max time.Duration) {
+	var total time.Duration
+	for i, rtt := range h.RTTs {
+		if i == 0 || rtt < min {
+			min = rtt
+		}
+		if max < rtt {
+			max = rtt
+		}
+		total += rtt
+	}
+	if len(h.RTTs) > 0 {
+		avg = total / time.Duration(len(h.RTTs))
+	}
+	return
+}
+
+func (p *TracerouteProbe) Run(ctx context.Context) (ms Metrics, err error) {
+	var ok bool
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, "elapsed.seconds", elapsed.Seconds()))
+		if ok {
+			ms = append(ms, newMetric(p, "check.ok", 1))
+		} else {
+			ms = append(ms, newMetric(p, "check.ok", 0))
+		}
+		slog.Debug("traceroute probe completed", "metrics", ms.String())
+	}()
+
+	network := "ip"
+	if p.IPVersion != 0 {
+		network = fmt.Sprintf("ip%d", p.IPVersion)
+	}
+	ipaddr, err := net.ResolveIPAddr(network, p.Address)
+	if err != nil {
+		return ms, fmt.Errorf("resolve failed: %w", err)
+	}
+	slog.Debug("address resolved", "address", p.Address, "ipaddr", ipaddr)
+
+	hops, reached, err := p.trace(ctx, ipaddr)
+	if err != nil {
+		return ms, err
+	}
+	ok = reached
+
+	var lossMax float64
+	var rttAvgMax time.Duration
+	path := make([]string, len(hops))
+	for i, h := range hops {
+		path[i] = h.Address
+		if h.Received == 0 {
+			path[i] = "*"
+			// routers which never reply to the probes (e.g. filtering ICMP) are not counted as loss
+			continue
+		}
+		min, avg, max := h.rtt()
+		loss := h.lossPercentage()
+		if lossMax < loss {
+			lossMax = loss
+		}
+		if rttAvgMax < avg {
+			rttAvgMax = avg
+		}
+		for _, m := range []Metric{
+			newMetric(p, "hop.loss.percentage", loss),
+			newMetric(p, "hop.rtt.min", min.Seconds()),
+			newMetric(p, "hop.rtt.avg", avg.Seconds()),
+			newMetric(p, "hop.rtt.max", max.Seconds()),
+		} {
+			m.Attribute = &Attribute{
+				Extra: map[string]string{
+					"hop":         strconv.Itoa(h.TTL),
+					"hop.address": h.Address,
+				},
+			}
+			m.OtelOnly = true
+			ms = append(ms, m)
+		}
+	}
+
+	var changed bool
+	key := p.hostID + "\t" + p.metricKeyPrefix + "\t" + p.Address
+	if prev, found := swapTraceroutePath(key, path); found {
+		changed = tracerouteChanged(prev, path)
+	}
+	if changed {
+		slog.Info("traceroute path changed", "address", p.Address, "path", strings.Join(path, " "))
+	}
+
+	ms = append(ms, newMetric(p, "hop.count", float64(len(hops))))
+	ms = append(ms, newMetric(p, "hop.loss.percentage.max", lossMax))
+	ms = append(ms, newMetric(p, "hop.rtt.avg.max", rttAvgMax.Seconds()))
+	if changed {
+		ms = append(ms, newMetric(p, "path.changed", 1))
+	} else {
+		ms = append(ms, newMetric(p, "path.changed", 0))
+	}
+	if len(hops) > 0 && reached {
+		last := hops[len(hops)-1]
+		min, avg, max := last.rtt()
+		ms = append(ms, newMetric(p, "loss.percentage", last.lossPercentage()))
+		ms = append(ms, newMetric(p, "rtt.min", min.Seconds()))
+		ms = append(ms, newMetric(p, "rtt.avg", avg.Seconds()))
+		ms = append(ms, newMetric(p, "rtt.max", max.Seconds()))
+	} else {
+		ms = append(ms, newMetric(p, "loss.percentage", 100))
+	}
+	if !reached {
+		return ms, fmt.Errorf("destination %s not reached within %d hops", ipaddr, p.MaxHops)
+	}
+	return ms, nil
+}
+
+// trace sends echo requests with TTL from 1 to the hop of the destination for Count rounds,
+// and returns the hops up to the destination (or up to the last hop replied when not reached).
+func (p *TracerouteProbe) trace(ctx context.Context, ipaddr *net.IPAddr) ([]*tracerouteHop, bool, error) {
+	v6 := ipaddr.IP.To4() == nil
+	network, address := icmpListenNetwork(ipaddr.IP, true)
+	conn, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		return nil, false, fmt.Errorf("traceroute requires root or CAP_NET_RAW: %w", err)
+	}
+	defer conn.Close()
+
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	proto := protocolICMP
+	setTTL := func(ttl int) error { return conn.IPv4PacketConn().SetTTL(ttl) }
+	if v6 {
+		typ, proto = ipv6.ICMPTypeEchoRequest, protocolIPv6ICMP
+		setTTL = func(ttl int) error { return conn.IPv6PacketConn().SetHopLimit(ttl) }
+	}
+	// raw sockets receive all ICMP messages, so the ID distinguishes replies for this run
+	id := (os.Getpid() + int(tracerouteEchoID.Add(1))) & 0xffff
+
+	hops := make([]*tracerouteHop, p.MaxHops)
+	for i := range hops {
+		hops[i] = &tracerouteHop{TTL: i + 1}
+	}
+	destination := p.MaxHops // the hop of the destination, shortened when found
+	reached := false
+	buf := make([]byte, 1500)
+
+	for round := 0; round < p.Count; round++ {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		sentAt := make(map[int]time.Time, destination)
+		for ttl := 1; ttl <= destination; ttl++ {
+			seq := round<<8 | ttl
+			b, err := (&icmp.Message{
+				Type: typ,
+				Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("maprobe")},
+			}).Marshal(nil)
+			if err != nil {
+				return nil, false, err
+			}
+			if err := setTTL(ttl); err != nil {
+				return nil, false, fmt.Errorf("failed to set TTL: %w", err)
+			}
+			sentAt[seq] = time.Now()
+			hops[ttl-1].Sent++
+			if _, err := conn.WriteTo(b, ipaddr); err != nil {
+				return nil, false, fmt.Errorf("send failed: %w", err)
+			}
+		}
+
+		conn.SetReadDeadline(time.Now().Add(p.Timeout))
+		for len(sentAt) > 0 {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, false, fmt.Errorf("read failed: %w", err)
+			}
+			receivedAt := time.Now()
+			m, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil {
+				continue
+			}
+			replyID, seq, final, found := parseTracerouteReply(m, v6)
+			if !found || replyID != id {
+				continue
+			}
+			t, found := sentAt[seq]
+			if !found {
+				continue // a late reply of the previous round
+			}
+			delete(sentAt, seq)
+			ttl := seq & 0xff
+			if destination < ttl {
+				continue
+			}
+			h := hops[ttl-1]
+			h.Received++
+			h.RTTs = append(h.RTTs, receivedAt.Sub(t))
+			if h.Address == "" {
+				h.Address = peerIP(peer)
+			}
+			slog.Debug("traceroute reply received", "ttl", ttl, "peer", peer, "rtt", receivedAt.Sub(t))
+			if final {
+				destination = ttl
+				reached = m.Type == ipv4.ICMPTypeEchoReply || m.Type == ipv6.ICMPTypeEchoReply
+			}
+		}
+	}
+
+	hops = hops[:destination]
+	if !reached {
+		// trailing hops without any reply are beyond the last reachable router
+		for len(hops) > 0 && hops[len(hops)-1].Received == 0 {
+			hops = hops[:len(hops)-1]
+		}
+	}
+	return hops, reached, nil
+}
+
+// parseTracerouteReply returns the ID and the sequence number of the echo request which the message replies to.
+// final is true when the message comes from the end of the path.
+func parseTracerouteReply(m *icmp.Message, v6 bool) (id, seq int, final, ok bool) {
+	switch body := m.Body.(type) {
+	case *icmp.Echo:
+		if m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply {
+			return 0, 0, false, false
+		}
+		return body.ID, body.Seq, true, true
+	case *icmp.TimeExceeded:
+		id, seq, ok := innerEcho(body.Data, v6)
+		return id, seq, false, ok
+	case *icmp.DstUnreach:
+		id, seq, ok := innerEcho(body.Data, v6)
+		return id, seq, true, ok
+	}
+	return 0, 0, false, false
+}
+
+// innerEcho returns the ID and the sequence number of the echo request
+// in the original datagram quoted by an ICMP error message.
+func innerEcho(data []byte, v6 bool) (int, int, bool) {
+	var off int
+	if v6 {
+		if len(data) < ipv6.HeaderLen || data[6] != protocolIPv6ICMP {
+			return 0, 0, false
+		}
+		off = ipv6.HeaderLen
+	} else {
+		if len(data) < ipv4.HeaderLen || data[9] != protocolICMP {
+			return 0, 0, false
+		}
+		off = int(data[0]&0x0f) * 4
+	}
+	if len(data) < off+8 {
+		return 0, 0, false
+	}
+	if typ := data[off]; typ != byte(ipv4.ICMPTypeEcho) && typ != byte(ipv6.ICMPTypeEchoRequest) {
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint16(data[off+4:])), int(binary.BigEndian.Uint16(data[off+6:])), true
+}
+
+func peerIP(addr net.Addr) string {
+	if a, ok := addr.(*net.IPAddr); ok {
+		return a.IP.String()
+	}
+	return addr.String()
+}
+
+// tracerouteChanged reports whether the path is changed from the previous one.
+// Hops without reply ("*") are not compared.
+func tracerouteChanged(prev, cur []string) bool {
+	if len(prev) != len(cur) {
+		return true
+	}
+	for i := range cur {
+		if prev[i] == "*" || cur[i] == "*" {
+			continue
+		}
+		if prev[i] != cur[i] {
+			return true
+		}
+	}
+	return false
+}
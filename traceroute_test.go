@@ -0,0 +1,113 @@
+package maprobe_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+func TestTraceroute(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		pc := &maprobe.TracerouteProbeConfig{Address: addr, Count: 2, Timeout: 500 * time.Millisecond}
+		probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test-" + addr}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			ms, err := probe.Run(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			checks := map[string]float64{
+				"traceroute.check.ok":        1,
+				"traceroute.hop.count":       1,
+				"traceroute.loss.percentage": 0,
+				"traceroute.path.changed":    0,
+			}
+			found := map[string]bool{}
+			for _, m := range ms {
+				if m.Name == "traceroute.hop.rtt.avg" {
+					found[m.Name] = true
+					if !m.OtelOnly {
+						t.Errorf("%s must be otel only", m.Name)
+					}
+					if m.Attribute == nil || m.Attribute.Extra["hop"] != "1" || m.Attribute.Extra["hop.address"] != addr {
+						t.Errorf("unexpected attribute of %s: %#v", m.Name, m.Attribute)
+					}
+					continue
+				}
+				if m.OtelOnly {
+					continue
+				}
+				if v, ok := checks[m.Name]; ok {
+					found[m.Name] = true
+					if m.Value != v {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, v)
+					}
+				}
+			}
+			for name := range checks {
+				if !found[name] {
+					t.Errorf("metric %s not found", name)
+				}
+			}
+			if !found["traceroute.hop.rtt.avg"] {
+				t.Error("metric traceroute.hop.rtt.avg not found")
+			}
+			t.Log(ms.String())
+		}
+	}
+}
+
+func TestTracerouteChanged(t *testing.T) {
+	tests := []struct {
+		prev, cur []string
+		changed   bool
+	}{
+		{[]string{"10.0.0.1", "10.0.1.1", "192.0.2.1"}, []string{"10.0.0.1", "10.0.1.1", "192.0.2.1"}, false},
+		{[]string{"10.0.0.1", "*", "192.0.2.1"}, []string{"10.0.0.1", "10.0.1.1", "192.0.2.1"}, false},
+		{[]string{"10.0.0.1", "10.0.1.1", "192.0.2.1"}, []string{"10.0.0.1", "10.0.2.1", "192.0.2.1"}, true},
+		{[]string{"10.0.0.1", "192.0.2.1"}, []string{"10.0.0.1", "10.0.1.1", "192.0.2.1"}, true},
+	}
+	for _, tt := range tests {
+		if changed := maprobe.TracerouteChanged(tt.prev, tt.cur); changed != tt.changed {
+			t.Errorf("unexpected changed %v -> %v: got %v", tt.prev, tt.cur, changed)
+		}
+	}
+}
+
+func TestTracerouteInvalid(t *testing.T) {
+	configs := []*maprobe.TracerouteProbeConfig{
+		{},
+		{Address: "127.0.0.1", IPVersion: 5},
+		{Address: "127.0.0.1", MaxHops: 256},
+		{Address: "127.0.0.1", Count: -1},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}
+
+func TestTraceroutePathsPurged(t *testing.T) {
+	defer func(ttl time.Duration) { maprobe.TraceroutePathTTL = ttl }(maprobe.TraceroutePathTTL)
+	maprobe.TraceroutePathTTL = time.Millisecond
+
+	maprobe.SwapTraceroutePath("purge-test-a", []string{"192.0.2.1"})
+	if prev, found := maprobe.SwapTraceroutePath("purge-test-a", []string{"192.0.2.2"}); !found || prev[0] != "192.0.2.1" {
+		t.Errorf("unexpected previous path %v", prev)
+	}
+	time.Sleep(10 * time.Millisecond)
+	maprobe.ResetTraceroutePathsPurged()
+	maprobe.SwapTraceroutePath("purge-test-b", []string{"192.0.2.3"})
+	if n := maprobe.TraceroutePathsLen(); n != 1 {
+		t.Errorf("stale paths are not purged: %d paths", n)
+	}
+	if _, found := maprobe.SwapTraceroutePath("purge-test-a", []string{"192.0.2.2"}); found {
+		t.Error("purged path must not be found")
+	}
+}
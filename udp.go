@@ -0,0 +1,231 @@
+package maprobe
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"time"
+)
+
+var (
+	DefaultUDPTimeout         = 5 * time.Second
+	DefaultUDPRetries         = 2
+	DefaultUDPMaxBytes        = 64 * 1024
+	DefaultUDPMetricKeyPrefix = "udp"
+)
+
+type UDPProbeConfig struct {
+	Host            string        `yaml:"host"`
+	Port            string        `yaml:"port"`
+	Timeout         time.Duration `yaml:"timeout"`
+	Send            string        `yaml:"send"`
+	SendHex         string        `yaml:"send_hex"`
+	ExpectPattern   string        `yaml:"expect_pattern"`
+	ExpectPrefixHex string        `yaml:"expect_prefix_hex"`
+	NoResponse      bool          `yaml:"no_response"`
+	Retries         *int          `yaml:"retries"`
+	MaxBytes        int           `yaml:"max_bytes"`
+	MetricKeyPrefix string        `yaml:"metric_key_prefix"`
+}
+
+func (pc *UDPProbeConfig) GenerateProbe(host *ProbeHost) (Probe, error) {
+	p := &UDPProbe{
+		hostID:          host.ID,
+		metricKeyPrefix: pc.MetricKeyPrefix,
+		Timeout:         pc.Timeout,
+		NoResponse:      pc.NoResponse,
+		Retries:         DefaultUDPRetries,
+		MaxBytes:        pc.MaxBytes,
+	}
+	var err error
+
+	p.Host, err = expandPlaceHolder(pc.Host, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host: %w", err)
+	}
+	if p.Host == "" {
+		return nil, fmt.Errorf("no host")
+	}
+
+	p.Port, err = expandPlaceHolder(pc.Port, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %w", err)
+	}
+	if p.Port == "" {
+		return nil, fmt.Errorf("no port")
+	}
+
+	switch {
+	case pc.Send != "" && pc.SendHex != "":
+		return nil, fmt.Errorf("send and send_hex are exclusive")
+	case pc.SendHex != "":
+		p.Send, err = hex.DecodeString(pc.SendHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid send_hex: %w", err)
+		}
+	default:
+		send, err := expandPlaceHolder(pc.Send, host, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid send: %w", err)
+		}
+		p.Send = []byte(send)
+	}
+	if len(p.Send) == 0 {
+		return nil, fmt.Errorf("no send")
+	}
+
+	pattern, err := expandPlaceHolder(pc.ExpectPattern, host, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+	}
+	if pattern != "" {
+		p.ExpectPattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect_pattern: %w", err)
+		}
+	}
+	if pc.ExpectPrefixHex != "" {
+		p.ExpectPrefix, err = hex.DecodeString(pc.ExpectPrefixHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect_prefix_hex: %w", err)
+		}
+	}
+	if p.NoResponse && (p.ExpectPattern != nil || p.ExpectPrefix != nil) {
+		return nil, fmt.Errorf("no_response and expect_pattern/expect_prefix_hex are exclusive")
+	}
+
+	if pc.Retries != nil {
+		if *pc.Retries < 0 {
+			return nil, fmt.Errorf("invalid retries %d", *pc.Retries)
+		}
+		p.Retries = *pc.Retries
+	}
+	if p.Timeout == 0 {
+		p.Timeout = DefaultUDPTimeout
+	}
+	if p.MaxBytes == 0 {
+		p.MaxBytes = DefaultUDPMaxBytes
+	}
+	if p.metricKeyPrefix == "" {
+		p.metricKeyPrefix = DefaultUDPMetricKeyPrefix
+	}
+	return p, nil
+}
+
+type UDPProbe struct {
+	hostID          string
+	metricKeyPrefix string
+
+	Host          string
+	Port          string
+	Timeout       time.Duration
+	Send          []byte
+	ExpectPattern *regexp.Regexp
+	ExpectPrefix  []byte
+	NoResponse    bool
+	Retries       int
+	MaxBytes      int
+}
+
+func (p *UDPProbe) HostID() string {
+	return p.hostID
+}
+
+func (p *UDPProbe) MetricName(name string) string {
+	return p.metricKeyPrefix + "." + name
+}
+
+func (p *UDPProbe) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+func (p *UDPProbe) match(b []byte) bool {
+	if p.ExpectPrefix != nil && !bytes.HasPrefix(b, p.ExpectPrefix) {
+		return false
+	}
+	if p.ExpectPattern != nil && !p.ExpectPattern.Match(b) {
+		return false
+	}
+	return true
+}
+
+func (p *UDPProbe) Run(ctx context.Context) (ms Metrics, err error) {
+	var ok bool
+	var attempts int
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		ms = append(ms, newMetric(p, "elapsed.seconds", elapsed.Seconds()))
+		ms = append(ms, newMetric(p, "attempts", float64(attempts)))
+		if ok {
+			ms = append(ms, newMetric(p, "check.ok", 1))
+		} else {
+			ms = append(ms, newMetric(p, "check.ok", 0))
+		}
+		slog.Debug("udp probe completed", "metrics", ms.String())
+	}()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(p.Host, p.Port)
+	slog.Debug("dialing", "addr", addr)
+	var d net.Dialer
+	conn, err := d.DialContext(timeoutCtx, "udp", addr)
+	if err != nil {
+		return ms, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+
+	// retries are done within the timeout
+	wait := time.Until(start.Add(p.Timeout)) / time.Duration(p.Retries+1)
+	buf := make([]byte, p.MaxBytes)
+	var unexpected bool
+	for attempts < p.Retries+1 {
+		if err := timeoutCtx.Err(); err != nil {
+			return ms, err
+		}
+		attempts++
+		sentAt := time.Now()
+		conn.SetDeadline(sentAt.Add(wait))
+		slog.Debug("send", "addr", addr, "attempt", attempts)
+		if _, err := conn.Write(p.Send); err != nil {
+			return ms, fmt.Errorf("send failed: %w", err)
+		}
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				// e.g. connection refused by ICMP port unreachable
+				return ms, fmt.Errorf("read failed: %w", err)
+			}
+			slog.Debug("read", "data", string(buf[:n]))
+			if p.match(buf[:n]) {
+				ms = append(ms, newMetric(p, "rtt.seconds", time.Since(sentAt).Seconds()))
+				ok = true
+				return ms, nil
+			}
+			// a response may be a late reply to the previous attempt
+			unexpected = true
+		}
+		if p.NoResponse {
+			// no error (e.g. port unreachable) is reported while waiting
+			ok = true
+			return ms, nil
+		}
+	}
+	if unexpected {
+		return ms, fmt.Errorf("unexpected response")
+	}
+	return ms, fmt.Errorf("no response")
+}
@@ -0,0 +1,163 @@
+package maprobe_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/maprobe"
+	mackerel "github.com/mackerelio/mackerel-client-go"
+)
+
+// testUDPServer replies "PONG <payload>" to "PING <payload>" and 0x02 to 0x01,
+// and drops the first request of each "DROP" payload.
+func testUDPServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var dropped atomic.Bool
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			switch {
+			case bytes.HasPrefix(req, []byte("PING ")):
+				conn.WriteTo(append([]byte("PONG "), req[5:]...), addr)
+			case bytes.Equal(req, []byte{0x01}):
+				conn.WriteTo([]byte{0x02, 0x00}, addr)
+			case bytes.Equal(req, []byte("DROP")):
+				if dropped.CompareAndSwap(false, true) {
+					continue
+				}
+				conn.WriteTo([]byte("OK"), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestUDP(t *testing.T) {
+	host, port, _ := net.SplitHostPort(testUDPServer(t))
+	zero := 0
+
+	tests := []struct {
+		name        string
+		config      maprobe.UDPProbeConfig
+		expectError bool
+		checks      map[string]float64
+	}{
+		{
+			name:   "pattern",
+			config: maprobe.UDPProbeConfig{Send: "PING {{ .Host.Name }}", ExpectPattern: "^PONG test$"},
+			checks: map[string]float64{"udp.check.ok": 1, "udp.attempts": 1},
+		},
+		{
+			name:   "hex prefix",
+			config: maprobe.UDPProbeConfig{SendHex: "01", ExpectPrefixHex: "02"},
+			checks: map[string]float64{"udp.check.ok": 1, "udp.attempts": 1},
+		},
+		{
+			name:   "retry",
+			config: maprobe.UDPProbeConfig{Send: "DROP", ExpectPattern: "OK", Timeout: time.Second},
+			checks: map[string]float64{"udp.check.ok": 1, "udp.attempts": 2},
+		},
+		{
+			name:        "unexpected response",
+			config:      maprobe.UDPProbeConfig{Send: "PING foo", ExpectPattern: "bar", Timeout: 300 * time.Millisecond},
+			expectError: true,
+			checks:      map[string]float64{"udp.check.ok": 0, "udp.attempts": 3},
+		},
+		{
+			name:        "no response",
+			config:      maprobe.UDPProbeConfig{Send: "HELLO", Timeout: 300 * time.Millisecond, Retries: &zero},
+			expectError: true,
+			checks:      map[string]float64{"udp.check.ok": 0, "udp.attempts": 1},
+		},
+		{
+			name:   "no response expected",
+			config: maprobe.UDPProbeConfig{Send: "HELLO", Timeout: 300 * time.Millisecond, NoResponse: true},
+			checks: map[string]float64{"udp.check.ok": 1, "udp.attempts": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := tt.config
+			pc.Host = host
+			pc.Port = port
+			probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test", Name: "test"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, err := probe.Run(context.Background())
+			if tt.expectError && err == nil {
+				t.Error("expected error, but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			found := map[string]bool{}
+			for _, m := range ms {
+				if v, ok := tt.checks[m.Name]; ok {
+					found[m.Name] = true
+					if m.Value != v {
+						t.Errorf("unexpected %s: got %f, want %f", m.Name, m.Value, v)
+					}
+				}
+			}
+			for name := range tt.checks {
+				if !found[name] {
+					t.Errorf("metric %s not found", name)
+				}
+			}
+			t.Log(ms.String())
+		})
+	}
+}
+
+func TestUDPPortUnreachable(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	conn.Close()
+
+	pc := &maprobe.UDPProbeConfig{Host: host, Port: port, Send: "HELLO", NoResponse: true, Timeout: time.Second}
+	probe, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := probe.Run(context.Background()); err == nil {
+		t.Error("expected error, but got nil")
+	}
+}
+
+func TestUDPInvalid(t *testing.T) {
+	minus := -1
+	configs := []*maprobe.UDPProbeConfig{
+		{Port: "53", Send: "x"},
+		{Host: "localhost", Send: "x"},
+		{Host: "localhost", Port: "53"},
+		{Host: "localhost", Port: "53", Send: "x", SendHex: "01"},
+		{Host: "localhost", Port: "53", SendHex: "zz"},
+		{Host: "localhost", Port: "53", Send: "x", ExpectPrefixHex: "0"},
+		{Host: "localhost", Port: "53", Send: "x", ExpectPattern: "x", NoResponse: true},
+		{Host: "localhost", Port: "53", Send: "x", Retries: &minus},
+	}
+	for _, pc := range configs {
+		if _, err := pc.GenerateProbe(&maprobe.ProbeHost{Host: &mackerel.Host{ID: "test"}}); err == nil {
+			t.Errorf("must be failed %#v", pc)
+		}
+	}
+}